@@ -1,19 +1,112 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DeviceConfig describes a board to connect to on startup
+type DeviceConfig struct {
+	ID        string
+	Transport string
+	Port      string
+	BaudRate  int
+}
 
 // Config holds application configuration
 type Config struct {
-	Port     string
-	MongoURI string
+	Port              string
+	MongoURI          string
+	Simulator         bool
+	SimulatorScenario string
+	ProtocolVersion   int
+	TelemetryTimeout  int
+	CommandTTL        int
+	RestorePolicies   map[string]string
+	HasLocation       bool
+	Latitude          float64
+	Longitude         float64
+	AutoConnect       bool
+	DeviceTransport   string
+	DevicePort        string
+	DeviceBaudRate    int
+	Devices           []DeviceConfig
 }
 
 // Load loads configuration from environment variables with defaults
 func Load() *Config {
-	return &Config{
-		Port:     getEnv("PORT", "3000"),
-		MongoURI: getEnv("MONGODB_URI", "mongodb://localhost:27017/smarthome"),
+	cfg := &Config{
+		Port:              getEnv("PORT", "3000"),
+		MongoURI:          getEnv("MONGODB_URI", "mongodb://localhost:27017/smarthome"),
+		Simulator:         getEnvBool("SIMULATOR", false),
+		SimulatorScenario: getEnv("SIMULATOR_SCENARIO", "normal"),
+		ProtocolVersion:   getEnvInt("PROTOCOL_VERSION", 2),
+		TelemetryTimeout:  getEnvInt("TELEMETRY_TIMEOUT", 10),
+		CommandTTL:        getEnvInt("COMMAND_TTL", 300),
+		AutoConnect:       getEnvBool("DEVICE_AUTO_CONNECT", true),
+		DeviceTransport:   getEnv("DEVICE_TRANSPORT", "serial"),
+		DevicePort:        os.Getenv("DEVICE_PORT"),
+		DeviceBaudRate:    getEnvInt("DEVICE_BAUD_RATE", 9600),
+	}
+
+	// The simulator is a transport whose address is the scenario name
+	if cfg.Simulator {
+		cfg.DeviceTransport = "sim"
+		cfg.DevicePort = cfg.SimulatorScenario
+	}
+
+	cfg.Devices = parseDevices(os.Getenv("DEVICES"), cfg.DeviceBaudRate)
+	cfg.RestorePolicies = parseRestorePolicies(os.Getenv("RESTORE_POLICY"))
+
+	// Sunrise and sunset rule windows need both coordinates
+	latitude, latErr := strconv.ParseFloat(os.Getenv("LATITUDE"), 64)
+	longitude, lonErr := strconv.ParseFloat(os.Getenv("LONGITUDE"), 64)
+	if latErr == nil && lonErr == nil {
+		cfg.HasLocation = true
+		cfg.Latitude = latitude
+		cfg.Longitude = longitude
+	}
+	return cfg
+}
+
+// parseDevices parses additional boards given as a comma-separated list of
+// "id=transport:address" entries, e.g.
+// "garage=serial:/dev/ttyUSB1,greenhouse=tcp:10.0.0.5:4000"
+func parseDevices(value string, baudRate int) []DeviceConfig {
+	var devices []DeviceConfig
+	for _, entry := range strings.Split(value, ",") {
+		id, spec, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		transport, address, ok := strings.Cut(spec, ":")
+		if !ok {
+			continue
+		}
+		devices = append(devices, DeviceConfig{
+			ID:        strings.TrimSpace(id),
+			Transport: transport,
+			Port:      address,
+			BaudRate:  baudRate,
+		})
 	}
+	return devices
+}
+
+// parseRestorePolicies parses per-actuator restore policies given as a
+// comma-separated list of "actuator=policy" entries, e.g.
+// "door=restore,relay=force-off"
+func parseRestorePolicies(value string) map[string]string {
+	policies := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		actuator, policy, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		policies[strings.TrimSpace(actuator)] = strings.TrimSpace(policy)
+	}
+	return policies
 }
 
 // getEnv gets an environment variable with a fallback default value
@@ -23,3 +116,19 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvBool gets a boolean environment variable with a fallback default value
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvInt gets an integer environment variable with a fallback default value
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
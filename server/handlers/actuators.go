@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+	"github.com/caphefalumi/smart-home/serial"
+	"github.com/caphefalumi/smart-home/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ListActuators returns the catalogue of actuators and the values they accept
+func (h *Handlers) ListActuators(c *gin.Context) {
+	c.JSON(http.StatusOK, serial.ListActuators())
+}
+
+// SetActuator validates a typed actuator setting, e.g. {"speed": 128} for the
+// fan, and sends the matching command
+func (h *Handlers) SetActuator(c *gin.Context) {
+	device, ok := h.device(c)
+	if !ok {
+		return
+	}
+
+	actuator, ok := serial.GetActuator(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Actuator not found"})
+		return
+	}
+
+	var setting serial.ActuatorSetting
+	if err := c.ShouldBindJSON(&setting); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	command, err := actuator.Command(setting)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.sendCommand(c, device, command, "Actuator updated")
+}
+
+// GetActuatorStatuses returns the desired and reported state of each actuator
+// and whether the board confirmed it
+func (h *Handlers) GetActuatorStatuses(c *gin.Context) {
+	device, ok := h.device(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, device.GetActuatorStatuses())
+}
+
+// GetActuatorHistory returns paginated actuator changes, filtered by device,
+// actuator, origin kind and ID, and date range
+func (h *Handlers) GetActuatorHistory(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	skip, _ := strconv.Atoi(c.DefaultQuery("skip", "0"))
+
+	filter := services.ActuatorHistoryFilter{
+		DeviceID: h.deviceScope(c),
+		Actuator: c.Query("actuator"),
+		Origin:   c.Query("origin"),
+		OriginID: c.Query("originId"),
+	}
+
+	if startDateStr := c.Query("startDate"); startDateStr != "" {
+		if parsed, err := time.Parse(time.RFC3339, startDateStr); err == nil {
+			filter.StartDate = &parsed
+		}
+	}
+
+	if endDateStr := c.Query("endDate"); endDateStr != "" {
+		if parsed, err := time.Parse(time.RFC3339, endDateStr); err == nil {
+			filter.EndDate = &parsed
+		}
+	}
+
+	events, total, err := h.actuatorService.GetHistory(filter, limit, skip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Always return an array, never null
+	if events == nil {
+		events = []models.ActuatorEvent{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  events,
+		"total": total,
+		"limit": limit,
+		"skip":  skip,
+	})
+}
+
+// GetRestorePolicies returns how each actuator is restored after a board reset
+func (h *Handlers) GetRestorePolicies(c *gin.Context) {
+	device, ok := h.device(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, device.GetRestorePolicies())
+}
+
+// SetRestorePolicy changes how an actuator is restored after a board reset
+func (h *Handlers) SetRestorePolicy(c *gin.Context) {
+	device, ok := h.device(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Actuator string `json:"actuator" binding:"required"`
+		Policy   string `json:"policy" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := device.SetRestorePolicy(req.Actuator, req.Policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, device.GetRestorePolicies())
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+	"github.com/caphefalumi/smart-home/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// BacktestRule replays recorded sensor history through an existing rule,
+// given by "ruleId", or through a draft "rule", and reports when it would
+// have fired. The range defaults to the last 24 hours. The house mode is
+// taken from the mode log unless a fixed "mode" is given.
+func (h *Handlers) BacktestRule(c *gin.Context) {
+	var req struct {
+		RuleID   string       `json:"ruleId"`
+		Rule     *ruleRequest `json:"rule"`
+		DeviceID string       `json:"deviceId"`
+		Start    *time.Time   `json:"start"`
+		End      *time.Time   `json:"end"`
+		Mode     string       `json:"mode"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (req.RuleID == "") == (req.Rule == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "exactly one of ruleId or rule is required"})
+		return
+	}
+
+	var rule *models.Rule
+	var err error
+	if req.RuleID != "" {
+		rule, err = h.ruleService.GetRule(req.RuleID)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		rule, err = h.buildRule(req.Rule)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	end := time.Now()
+	if req.End != nil {
+		end = *req.End
+	}
+	start := end.Add(-24 * time.Hour)
+	if req.Start != nil {
+		start = *req.Start
+	}
+	if !end.After(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end must be after start"})
+		return
+	}
+	if end.Sub(start) > services.MaxBacktestRange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("backtests cover at most %d days", int(services.MaxBacktestRange.Hours()/24))})
+		return
+	}
+
+	deviceID := req.DeviceID
+	if deviceID == "" {
+		deviceID = rule.DeviceID
+	}
+	if deviceID == "" {
+		deviceID = models.DefaultDeviceID
+	}
+
+	var modes *services.ModeTimeline
+	if req.Mode != "" {
+		if err := models.ValidateMode(req.Mode); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		modes = services.FixedMode(req.Mode)
+	} else if modes, err = h.modeService.GetTimeline(start, end); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.ruleService.Backtest(rule, deviceID, start, end, h.sensorService, modes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/qiniu/qmgo"
+)
+
+// GetCommands returns recent commands, optionally filtered by device and by
+// a comma-separated list of statuses
+func (h *Handlers) GetCommands(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+
+	var statuses []string
+	if status := c.Query("status"); status != "" {
+		statuses = strings.Split(status, ",")
+	}
+
+	commands, err := h.commandService.GetCommands(h.deviceScope(c), statuses, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, commands)
+}
+
+// CancelCommand cancels a command that has not been sent yet
+func (h *Handlers) CancelCommand(c *gin.Context) {
+	command, err := h.commandService.GetCommand(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Command not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.commandService.CancelCommand(command.ID); err != nil {
+		if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Command is no longer pending"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Drop it from the queue of a connected device as well
+	if device, ok := h.devices.Get(command.DeviceID); ok {
+		device.CancelCommand(command.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Command canceled"})
+}
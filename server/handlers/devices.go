@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/caphefalumi/smart-home/serial"
+	"github.com/gin-gonic/gin"
+)
+
+// ListDevices returns every registered device with its connection status
+func (h *Handlers) ListDevices(c *gin.Context) {
+	c.JSON(http.StatusOK, h.devices.List())
+}
+
+// AddDevice registers a device and connects to it
+func (h *Handlers) AddDevice(c *gin.Context) {
+	var req struct {
+		ID        string `json:"id" binding:"required"`
+		Transport string `json:"transport"`
+		Address   string `json:"address" binding:"required"`
+		BaudRate  int    `json:"baudRate"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	address, err := serial.ResolveAddress(req.Transport, req.Address)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	transport, err := serial.NewTransport(req.Transport, address, req.BaudRate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	device, err := h.devices.Add(req.ID)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := device.Connect(transport); err != nil {
+		h.devices.Remove(req.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, serial.DeviceInfo{ID: req.ID, ConnectionStatus: device.GetConnectionStatus()})
+}
+
+// RemoveDevice disconnects a device and removes it from the registry
+func (h *Handlers) RemoveDevice(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := h.devices.Get(id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+
+	if err := h.devices.Remove(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device removed"})
+}
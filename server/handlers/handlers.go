@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -16,51 +17,108 @@ import (
 
 // Handlers contains all HTTP request handlers
 type Handlers struct {
-	serialService *serial.ArduinoSerial
-	sensorService *services.SensorService
-	ruleService   *services.RuleService
+	devices             *serial.Registry
+	sensorService       *services.SensorService
+	ruleService         *services.RuleService
+	commandService      *services.CommandService
+	actuatorService     *services.ActuatorService
+	scheduleService     *services.ScheduleService
+	sceneService        *services.SceneService
+	modeService         *services.ModeService
+	notificationService *services.NotificationService
+	scheduler           *serial.Scheduler
 }
 
 // NewHandlers creates a new handlers instance
-func NewHandlers(serialService *serial.ArduinoSerial, sensorService *services.SensorService, ruleService *services.RuleService) *Handlers {
+func NewHandlers(devices *serial.Registry, sensorService *services.SensorService, ruleService *services.RuleService, commandService *services.CommandService, actuatorService *services.ActuatorService, scheduleService *services.ScheduleService, sceneService *services.SceneService, modeService *services.ModeService, notificationService *services.NotificationService, scheduler *serial.Scheduler) *Handlers {
 	return &Handlers{
-		serialService: serialService,
-		sensorService: sensorService,
-		ruleService:   ruleService,
+		devices:             devices,
+		sensorService:       sensorService,
+		ruleService:         ruleService,
+		commandService:      commandService,
+		actuatorService:     actuatorService,
+		scheduleService:     scheduleService,
+		sceneService:        sceneService,
+		modeService:         modeService,
+		notificationService: notificationService,
+		scheduler:           scheduler,
 	}
 }
 
+// device returns the device addressed by the ":id" route parameter. Legacy
+// routes without it address the default device.
+func (h *Handlers) device(c *gin.Context) (*serial.ArduinoSerial, bool) {
+	id := c.Param("id")
+	if id == "" {
+		id = models.DefaultDeviceID
+	}
+
+	device, ok := h.devices.Get(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return nil, false
+	}
+	return device, true
+}
+
+// deviceScope returns the device ID that stored data should be scoped to,
+// taken from the route or the "deviceId" query parameter. Empty means all devices.
+func (h *Handlers) deviceScope(c *gin.Context) string {
+	if id := c.Param("id"); id != "" {
+		return id
+	}
+	return c.Query("deviceId")
+}
+
+// userOrigin identifies the user behind a request by the X-User header,
+// falling back to the client address
+func userOrigin(c *gin.Context) models.Origin {
+	user := c.GetHeader("X-User")
+	if user == "" {
+		user = c.ClientIP()
+	}
+	return models.Origin{Kind: models.OriginUser, ID: user}
+}
+
 // HealthCheck returns the health status of the server
 func (h *Handlers) HealthCheck(c *gin.Context) {
+	device, ok := h.device(c)
+	if !ok {
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":           "ok",
-		"arduinoConnected": h.serialService.IsConnected(),
+		"arduinoConnected": device.IsConnected(),
+		"connectionState":  device.GetConnectionStatus().State,
+		"transport":        device.GetTransportInfo(),
 		"mongodbConnected": true, // Simplified - in production you'd check actual DB connection
 	})
 }
 
-// ListSerialPorts returns available serial ports
+// ListSerialPorts returns available serial ports with their USB metadata
 func (h *Handlers) ListSerialPorts(c *gin.Context) {
-	ports, err := h.serialService.ListPorts()
+	ports, err := serial.ListPorts()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "ports": []string{}})
 		return
 	}
-	// Log the detected ports to the console
-	fmt.Println("Detected serial ports:", ports)
-	// Return as [{ name: "COM3" }, ...] for frontend compatibility
-	var result []map[string]string
-	for _, port := range ports {
-		result = append(result, map[string]string{"name": port})
-	}
-	c.JSON(http.StatusOK, result)
+	// Each entry keeps the "name" field for frontend compatibility
+	c.JSON(http.StatusOK, ports)
 }
 
-// ConnectSerial connects to Arduino via serial port
+// ConnectSerial connects to Arduino over a serial port or TCP bridge
 func (h *Handlers) ConnectSerial(c *gin.Context) {
+	device, ok := h.device(c)
+	if !ok {
+		return
+	}
+
 	var req struct {
-		Port     string `json:"port" binding:"required"`
-		BaudRate int    `json:"baudRate"`
+		Transport string `json:"transport"`
+		Address   string `json:"address"`
+		Port      string `json:"port"`
+		BaudRate  int    `json:"baudRate"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -68,25 +126,50 @@ func (h *Handlers) ConnectSerial(c *gin.Context) {
 		return
 	}
 
+	// Older clients only send the COM port name
+	if req.Address == "" {
+		req.Address = req.Port
+	}
+
 	if req.BaudRate == 0 {
 		req.BaudRate = 9600
 	}
 
-	err := h.serialService.Connect(req.Port, req.BaudRate)
+	// Accept "auto", by-id names and serial numbers as well as device paths
+	address, err := serial.ResolveAddress(req.Transport, req.Address)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	transport, err := serial.NewTransport(req.Transport, address, req.BaudRate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = device.Connect(transport)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	info := transport.Info()
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Connected to Arduino",
-		"port":    req.Port,
+		"message":   "Connected to Arduino",
+		"transport": info.Kind,
+		"port":      info.Address,
 	})
 }
 
 // DisconnectSerial disconnects from Arduino
 func (h *Handlers) DisconnectSerial(c *gin.Context) {
-	err := h.serialService.Disconnect()
+	device, ok := h.device(c)
+	if !ok {
+		return
+	}
+
+	err := device.Disconnect()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -97,8 +180,14 @@ func (h *Handlers) DisconnectSerial(c *gin.Context) {
 
 // SendSerialCommand sends a command to Arduino
 func (h *Handlers) SendSerialCommand(c *gin.Context) {
+	device, ok := h.device(c)
+	if !ok {
+		return
+	}
+
 	var req struct {
-		Command string `json:"command" binding:"required"`
+		Command   string `json:"command" binding:"required"`
+		ExpiresIn int    `json:"expiresIn"` // seconds, the server default when zero
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -106,48 +195,147 @@ func (h *Handlers) SendSerialCommand(c *gin.Context) {
 		return
 	}
 
-	if !h.serialService.IsConnected() {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Arduino not connected"})
+	if err := serial.ValidateCommand(req.Command); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	err := h.serialService.SendCommand(req.Command)
+	// Commands for a disconnected board are queued until it is back
+	h.sendCommandWithOptions(c, device, req.Command, "Command sent", serial.CommandOptions{
+		TTL: time.Duration(req.ExpiresIn) * time.Second,
+	})
+}
+
+// sendCommand sends a command to Arduino and maps its result to an HTTP response
+func (h *Handlers) sendCommand(c *gin.Context, device *serial.ArduinoSerial, command, message string) {
+	h.sendCommandWithOptions(c, device, command, message, serial.CommandOptions{})
+}
+
+// sendCommandWithOptions is sendCommand with queueing options
+func (h *Handlers) sendCommandWithOptions(c *gin.Context, device *serial.ArduinoSerial, command, message string, options serial.CommandOptions) {
+	if options.Origin.Kind == "" {
+		options.Origin = userOrigin(c)
+	}
+
+	result, err := device.SendCommandWithOptions(command, options)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	switch result.Status {
+	case serial.CommandSucceeded:
+		c.JSON(http.StatusOK, gin.H{
+			"message": message,
+			"command": command,
+			"result":  result,
+		})
+	case serial.CommandQueued:
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "Command queued until Arduino reconnects",
+			"command": command,
+			"result":  result,
+		})
+	case serial.CommandSuperseded:
+		c.JSON(http.StatusConflict, gin.H{"error": "Command superseded by a later command", "result": result})
+	case serial.CommandExpired:
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Command expired before it reached Arduino", "result": result})
+	case serial.CommandTimedOut:
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Arduino did not acknowledge the command", "result": result})
+	case serial.CommandCanceled:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Command canceled, Arduino disconnected", "result": result})
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Arduino rejected the command", "result": result})
+	}
+}
+
+// GetConnectionStatus returns the link state and its recent transitions
+func (h *Handlers) GetConnectionStatus(c *gin.Context) {
+	device, ok := h.device(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, device.GetConnectionStatus())
+}
+
+// GetProtocolStats returns the negotiated line protocol and frame counters
+func (h *Handlers) GetProtocolStats(c *gin.Context) {
+	device, ok := h.device(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, device.GetProtocolStats())
+}
+
+// SetSimulatorScenario switches the scripted scenario of the simulated board
+func (h *Handlers) SetSimulatorScenario(c *gin.Context) {
+	device, ok := h.device(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Scenario string `json:"scenario" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := device.SetSimulatorScenario(req.Scenario); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Command sent",
-		"command": req.Command,
+		"message":  "Simulator scenario updated",
+		"scenario": req.Scenario,
 	})
 }
 
 // GetCurrentSensorData returns current sensor readings
 func (h *Handlers) GetCurrentSensorData(c *gin.Context) {
-	if !h.serialService.IsConnected() {
+	device, ok := h.device(c)
+	if !ok {
+		return
+	}
+
+	if !device.IsConnected() {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Arduino not connected"})
 		return
 	}
 
-	data := h.serialService.GetCurrentData()
+	data := device.GetCurrentData()
 	c.JSON(http.StatusOK, data)
 }
 
 // GetActuatorStates returns current actuator states
 func (h *Handlers) GetActuatorStates(c *gin.Context) {
-	if !h.serialService.IsConnected() {
+	device, ok := h.device(c)
+	if !ok {
+		return
+	}
+
+	if !device.IsConnected() {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Arduino not connected"})
 		return
 	}
 
-	states := h.serialService.GetActuatorStates()
+	states := device.GetActuatorStates()
 	c.JSON(http.StatusOK, states)
 }
 
 // SyncActuatorState manually sets actuator state for synchronization
 func (h *Handlers) SyncActuatorState(c *gin.Context) {
-	if !h.serialService.IsConnected() {
+	device, ok := h.device(c)
+	if !ok {
+		return
+	}
+
+	if !device.IsConnected() {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Arduino not connected"})
 		return
 	}
@@ -162,7 +350,16 @@ func (h *Handlers) SyncActuatorState(c *gin.Context) {
 		return
 	}
 
-	h.serialService.SetActuatorState(req.Actuator, req.Value)
+	name, setting, err := serial.ParseStateField(req.Actuator, req.Value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := device.SetActuatorState(name, setting); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":  "Actuator state updated",
@@ -190,7 +387,7 @@ func (h *Handlers) GetSensorHistory(c *gin.Context) {
 		}
 	}
 
-	data, total, err := h.sensorService.GetSensorHistory(limit, skip, startDate, endDate)
+	data, total, err := h.sensorService.GetSensorHistory(h.deviceScope(c), limit, skip, startDate, endDate)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -225,7 +422,7 @@ func (h *Handlers) GetStatistics(c *gin.Context) {
 		}
 	}
 
-	stats, err := h.sensorService.GetStatistics(sensor, hours)
+	stats, err := h.sensorService.GetStatistics(h.deviceScope(c), sensor, hours)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -238,7 +435,7 @@ func (h *Handlers) GetStatistics(c *gin.Context) {
 func (h *Handlers) GetTrends(c *gin.Context) {
 	hours, _ := strconv.Atoi(c.DefaultQuery("hours", "24"))
 
-	trends, err := h.sensorService.GetTrends(hours)
+	trends, err := h.sensorService.GetTrends(h.deviceScope(c), hours)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -255,48 +452,122 @@ func (h *Handlers) GetRules(c *gin.Context) {
 		return
 	}
 
+	// Keep rules that apply to the requested device
+	if deviceID := h.deviceScope(c); deviceID != "" {
+		scoped := make([]models.Rule, 0, len(rules))
+		for _, rule := range rules {
+			if rule.DeviceID == "" || rule.DeviceID == deviceID {
+				scoped = append(scoped, rule)
+			}
+		}
+		rules = scoped
+	}
+
 	// Add logging to see rule structure
 	log.Printf("GetRules: Returning %d rules", len(rules))
 	for i, rule := range rules {
 		log.Printf("Rule %d: ID=%s, Name=%s", i, rule.ID.Hex(), rule.Name)
 	}
 
+	now := time.Now()
+	for i := range rules {
+		h.setInWindow(&rules[i], now)
+	}
+
 	c.JSON(http.StatusOK, rules)
 }
 
-// CreateRule creates a new rule
-func (h *Handlers) CreateRule(c *gin.Context) {
-	var rule struct {
-		Name        string `json:"name" binding:"required"`
-		Sensor      string `json:"sensor" binding:"required,oneof=gas light soil water infrar"`
-		Operator    string `json:"operator" binding:"required,oneof=> < >= <= =="`
-		Threshold   int    `json:"threshold" binding:"required"`
-		Action      string `json:"action" binding:"required"`
-		Enabled     bool   `json:"enabled"`
-		Description string `json:"description"`
+// ruleRequest is the body of rule create requests and of draft rules to
+// backtest
+type ruleRequest struct {
+	Name           string                `json:"name" binding:"required"`
+	DeviceID       string                `json:"deviceId"`
+	Condition      *models.Condition     `json:"condition"`
+	Sensor         string                `json:"sensor" binding:"omitempty,oneof=gas light soil water infrar"`
+	Operator       string                `json:"operator" binding:"omitempty,oneof=> < >= <= == !="`
+	Threshold      int                   `json:"threshold"`
+	ForSeconds     int                   `json:"forSeconds" binding:"min=0,max=86400"`
+	ForSamples     int                   `json:"forSamples" binding:"min=0,max=10000"`
+	ClearCondition *models.Condition     `json:"clearCondition"`
+	Action         string                `json:"action"`
+	Actions        []models.RuleAction   `json:"actions"`
+	ClearActions   []models.RuleAction   `json:"clearActions"`
+	Windows        []models.ActiveWindow `json:"windows"`
+	Modes          []string              `json:"modes"`
+	Enabled        bool                  `json:"enabled"`
+	Description    string                `json:"description"`
+}
+
+// buildRule validates a rule request and returns the rule it describes
+func (h *Handlers) buildRule(req *ruleRequest) (*models.Rule, error) {
+	if req.Condition == nil && (req.Sensor == "" || req.Operator == "") {
+		return nil, fmt.Errorf("either condition or sensor and operator are required")
+	}
+
+	rule := &models.Rule{
+		Name:           req.Name,
+		DeviceID:       req.DeviceID,
+		Condition:      req.Condition,
+		Sensor:         req.Sensor,
+		Operator:       req.Operator,
+		Threshold:      req.Threshold,
+		ForSeconds:     req.ForSeconds,
+		ForSamples:     req.ForSamples,
+		ClearCondition: req.ClearCondition,
+		Action:         req.Action,
+		Actions:        req.Actions,
+		ClearActions:   req.ClearActions,
+		Windows:        req.Windows,
+		Modes:          req.Modes,
+		Enabled:        req.Enabled,
+		Description:    req.Description,
+	}
+
+	if err := rule.EffectiveCondition().Validate(); err != nil {
+		return nil, err
+	}
+	if err := serial.ValidateRuleActions(rule.EffectiveActions()); err != nil {
+		return nil, err
+	}
+	if rule.ClearCondition != nil {
+		if err := rule.ClearCondition.Validate(); err != nil {
+			return nil, fmt.Errorf("clearCondition: %w", err)
+		}
+	}
+	if len(rule.ClearActions) > 0 {
+		if err := serial.ValidateRuleActions(rule.ClearActions); err != nil {
+			return nil, fmt.Errorf("clearActions: %w", err)
+		}
+	}
+	if err := h.ruleService.ValidateWindows(rule.Windows); err != nil {
+		return nil, err
 	}
+	if err := models.ValidateModes(rule.Modes); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
 
-	if err := c.ShouldBindJSON(&rule); err != nil {
+// CreateRule creates a new rule
+func (h *Handlers) CreateRule(c *gin.Context) {
+	var req ruleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		log.Printf("CreateRule: bind error: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	newRule := &models.Rule{
-		Name:        rule.Name,
-		Sensor:      rule.Sensor,
-		Operator:    rule.Operator,
-		Threshold:   rule.Threshold,
-		Action:      rule.Action,
-		Enabled:     rule.Enabled,
-		Description: rule.Description,
+	newRule, err := h.buildRule(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	err := h.ruleService.CreateRule(newRule)
-	if err != nil {
+	if err := h.ruleService.CreateRule(newRule); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	h.setInWindow(newRule, time.Now())
 
 	c.JSON(http.StatusCreated, newRule)
 }
@@ -317,6 +588,11 @@ func (h *Handlers) UpdateRule(c *gin.Context) {
 
 	log.Printf("UpdateRule: Updates: %+v", updates)
 
+	if err := h.decodeRuleUpdates(updates); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	rule, err := h.ruleService.UpdateRule(id, updates)
 	if err != nil {
 		log.Printf("UpdateRule: Service error: %v", err)
@@ -327,10 +603,106 @@ func (h *Handlers) UpdateRule(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	h.setInWindow(rule, time.Now())
 
 	c.JSON(http.StatusOK, rule)
 }
 
+// setInWindow reports whether a rule is currently inside its active windows
+func (h *Handlers) setInWindow(rule *models.Rule, now time.Time) {
+	inWindow := h.ruleService.InWindow(rule, now)
+	rule.InWindow = &inWindow
+}
+
+// decodeRuleUpdates validates the structured fields of a rule update and
+// replaces them with their typed values, so they are stored like new rules
+func (h *Handlers) decodeRuleUpdates(updates map[string]interface{}) error {
+	for _, key := range []string{"condition", "clearCondition"} {
+		value, ok := updates[key]
+		if !ok || value == nil {
+			continue
+		}
+		var condition models.Condition
+		if err := decodeJSON(value, &condition); err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+		if err := condition.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		updates[key] = condition
+	}
+
+	for _, key := range []string{"actions", "clearActions"} {
+		value, ok := updates[key]
+		if !ok || value == nil {
+			continue
+		}
+		var actions []models.RuleAction
+		if err := decodeJSON(value, &actions); err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+		// Clear actions are optional, so an empty list removes them
+		if key == "actions" || len(actions) > 0 {
+			if err := serial.ValidateRuleActions(actions); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+		updates[key] = actions
+	}
+
+	if value, ok := updates["windows"]; ok && value != nil {
+		var windows []models.ActiveWindow
+		if err := decodeJSON(value, &windows); err != nil {
+			return fmt.Errorf("invalid windows: %w", err)
+		}
+		if err := h.ruleService.ValidateWindows(windows); err != nil {
+			return err
+		}
+		updates["windows"] = windows
+	}
+
+	if value, ok := updates["modes"]; ok && value != nil {
+		var modes []string
+		if err := decodeJSON(value, &modes); err != nil {
+			return fmt.Errorf("invalid modes: %w", err)
+		}
+		if err := models.ValidateModes(modes); err != nil {
+			return err
+		}
+		updates["modes"] = modes
+	}
+
+	if value, ok := updates["action"]; ok {
+		action, _ := value.(string)
+		if err := serial.ValidateCommand(action); err != nil {
+			return err
+		}
+	}
+
+	for key, max := range map[string]float64{"forSeconds": 86400, "forSamples": 10000} {
+		value, ok := updates[key]
+		if !ok {
+			continue
+		}
+		number, isNumber := value.(float64)
+		if !isNumber || number != float64(int(number)) || number < 0 || number > max {
+			return fmt.Errorf("%s must be an integer between 0 and %g", key, max)
+		}
+		updates[key] = int(number)
+	}
+
+	return nil
+}
+
+// decodeJSON converts a value from a JSON body into a typed target
+func decodeJSON(value, target interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, target)
+}
+
 // DeleteRule deletes a rule
 func (h *Handlers) DeleteRule(c *gin.Context) {
 	id := c.Param("id")
@@ -356,7 +728,7 @@ func (h *Handlers) DeleteRule(c *gin.Context) {
 func (h *Handlers) GetAlerts(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
 
-	alerts, err := h.sensorService.GetAlerts(limit)
+	alerts, err := h.sensorService.GetAlerts(h.deviceScope(c), limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "alerts": []interface{}{}})
 		return
@@ -369,50 +741,67 @@ func (h *Handlers) GetAlerts(c *gin.Context) {
 	c.JSON(http.StatusOK, alerts)
 }
 
+// GetNotifications returns the latest messages of notify actions
+func (h *Handlers) GetNotifications(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	notifications, err := h.notificationService.GetNotifications(h.deviceScope(c), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if notifications == nil {
+		notifications = []models.Notification{}
+	}
+	c.JSON(http.StatusOK, notifications)
+}
+
+// musicOptions queue songs behind other commands. Songs are not persisted, so
+// a song is never replayed after a restart.
+var musicOptions = serial.CommandOptions{Priority: serial.PriorityLow, Ephemeral: true}
+
 // PlayBirthdaySong plays the birthday song
 func (h *Handlers) PlayBirthdaySong(c *gin.Context) {
-	if !h.serialService.IsConnected() {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Arduino not connected"})
+	device, ok := h.device(c)
+	if !ok {
 		return
 	}
 
-	err := h.serialService.SendCommand("play_birthday")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !device.IsConnected() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Arduino not connected"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Playing birthday song"})
+	h.sendCommandWithOptions(c, device, "play_birthday", "Playing birthday song", musicOptions)
 }
 
 // PlayOdeToJoy plays Ode to Joy
 func (h *Handlers) PlayOdeToJoy(c *gin.Context) {
-	if !h.serialService.IsConnected() {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Arduino not connected"})
+	device, ok := h.device(c)
+	if !ok {
 		return
 	}
 
-	err := h.serialService.SendCommand("play_ode_to_joy")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !device.IsConnected() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Arduino not connected"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Playing Ode to Joy"})
+	h.sendCommandWithOptions(c, device, "play_ode_to_joy", "Playing Ode to Joy", musicOptions)
 }
 
 // StopMusic stops the currently playing music
 func (h *Handlers) StopMusic(c *gin.Context) {
-	if !h.serialService.IsConnected() {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Arduino not connected"})
+	device, ok := h.device(c)
+	if !ok {
 		return
 	}
 
-	err := h.serialService.SendCommand("stop_music")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !device.IsConnected() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Arduino not connected"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Music stopped"})
+	h.sendCommand(c, device, "stop_music", "Music stopped")
 }
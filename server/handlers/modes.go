@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/caphefalumi/smart-home/models"
+	"github.com/gin-gonic/gin"
+)
+
+// GetMode returns the current house mode and when it was set
+func (h *Handlers) GetMode(c *gin.Context) {
+	mode, since := h.modeService.GetModeSince()
+
+	response := gin.H{"mode": mode}
+	if !since.IsZero() {
+		response["since"] = since
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// SetMode switches the house mode
+func (h *Handlers) SetMode(c *gin.Context) {
+	var req struct {
+		Mode string `json:"mode" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := models.ValidateMode(req.Mode); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	change, err := h.modeService.SetMode(req.Mode, userOrigin(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mode":    req.Mode,
+		"changed": change != nil,
+		"change":  change,
+	})
+}
+
+// GetModeHistory returns the latest house mode changes
+func (h *Handlers) GetModeHistory(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	changes, err := h.modeService.GetHistory(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if changes == nil {
+		changes = []models.ModeChange{}
+	}
+	c.JSON(http.StatusOK, changes)
+}
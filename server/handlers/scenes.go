@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/caphefalumi/smart-home/models"
+	"github.com/caphefalumi/smart-home/serial"
+	"github.com/gin-gonic/gin"
+	"github.com/qiniu/qmgo"
+)
+
+// sceneRequest is the body of scene create and update requests. States are
+// booleans for switches and integers for angles and speeds.
+type sceneRequest struct {
+	Name        string                 `json:"name" binding:"required"`
+	Description string                 `json:"description"`
+	States      map[string]interface{} `json:"states" binding:"required"`
+}
+
+// GetScenes returns all scenes
+func (h *Handlers) GetScenes(c *gin.Context) {
+	scenes, err := h.sceneService.GetScenes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if scenes == nil {
+		scenes = []models.Scene{}
+	}
+	c.JSON(http.StatusOK, scenes)
+}
+
+// GetScene returns a scene
+func (h *Handlers) GetScene(c *gin.Context) {
+	scene, ok := h.scene(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, scene)
+}
+
+// CreateScene creates a scene from target actuator states
+func (h *Handlers) CreateScene(c *gin.Context) {
+	var req sceneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	states, err := serial.ParseSceneStates(req.States)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scene := &models.Scene{Name: req.Name, Description: req.Description, States: states}
+	if err := h.sceneService.CreateScene(scene); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, scene)
+}
+
+// SnapshotScene creates a scene from the current state of a device's
+// actuators, optionally limited to some of them
+func (h *Handlers) SnapshotScene(c *gin.Context) {
+	var req struct {
+		Name        string   `json:"name" binding:"required"`
+		Description string   `json:"description"`
+		DeviceID    string   `json:"deviceId"`
+		Actuators   []string `json:"actuators"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.DeviceID == "" {
+		req.DeviceID = models.DefaultDeviceID
+	}
+	device, ok := h.devices.Get(req.DeviceID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+
+	states, err := device.SnapshotScene(req.Actuators)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scene := &models.Scene{Name: req.Name, Description: req.Description, States: states}
+	if err := h.sceneService.CreateScene(scene); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, scene)
+}
+
+// UpdateScene replaces the name, description and states of a scene
+func (h *Handlers) UpdateScene(c *gin.Context) {
+	scene, ok := h.scene(c)
+	if !ok {
+		return
+	}
+
+	var req sceneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	states, err := serial.ParseSceneStates(req.States)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scene.Name = req.Name
+	scene.Description = req.Description
+	scene.States = states
+	if err := h.sceneService.UpdateScene(scene); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, scene)
+}
+
+// DeleteScene deletes a scene
+func (h *Handlers) DeleteScene(c *gin.Context) {
+	scene, ok := h.scene(c)
+	if !ok {
+		return
+	}
+
+	if err := h.sceneService.DeleteScene(scene.ID.Hex()); err != nil {
+		if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Scene not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Scene deleted"})
+}
+
+// ActivateScene sends the commands that bring a device to a scene, skipping
+// actuators already in their target state. The device is given by the
+// "deviceId" query parameter and defaults to the default board.
+func (h *Handlers) ActivateScene(c *gin.Context) {
+	scene, ok := h.scene(c)
+	if !ok {
+		return
+	}
+
+	device, ok := h.devices.Get(c.DefaultQuery("deviceId", models.DefaultDeviceID))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+
+	activation := device.ActivateScene(scene, models.Origin{Kind: models.OriginScene, ID: scene.ID.Hex()})
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Scene activated: " + scene.Name,
+		"commands":  activation.Commands,
+		"unchanged": activation.Unchanged,
+	})
+}
+
+// scene loads the scene addressed by the ":id" route parameter
+func (h *Handlers) scene(c *gin.Context) (*models.Scene, bool) {
+	scene, err := h.sceneService.GetScene(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Scene not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return scene, true
+}
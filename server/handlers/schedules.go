@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+	"github.com/caphefalumi/smart-home/serial"
+	"github.com/caphefalumi/smart-home/services"
+	"github.com/gin-gonic/gin"
+	"github.com/qiniu/qmgo"
+)
+
+// scheduleRequest is the body of schedule create and update requests
+type scheduleRequest struct {
+	Name      string              `json:"name" binding:"required"`
+	DeviceID  string              `json:"deviceId"`
+	Cron      string              `json:"cron"`
+	At        *time.Time          `json:"at"`
+	Actions   []models.RuleAction `json:"actions" binding:"required"`
+	MissedRun string              `json:"missedRun"`
+	Modes     []string            `json:"modes"`
+	Enabled   *bool               `json:"enabled"`
+}
+
+// applySchedule validates the request and copies it onto a schedule
+func (h *Handlers) applySchedule(req *scheduleRequest, schedule *models.Schedule) error {
+	schedule.Name = req.Name
+	schedule.DeviceID = req.DeviceID
+	if schedule.DeviceID == "" {
+		schedule.DeviceID = models.DefaultDeviceID
+	}
+	schedule.Cron = req.Cron
+	schedule.At = req.At
+	schedule.Actions = req.Actions
+	schedule.MissedRun = req.MissedRun
+	if schedule.MissedRun == "" {
+		schedule.MissedRun = models.MissedSkip
+	}
+	schedule.Modes = req.Modes
+	schedule.Enabled = req.Enabled == nil || *req.Enabled
+
+	if _, ok := h.devices.Get(schedule.DeviceID); !ok {
+		return fmt.Errorf("device %q not found", schedule.DeviceID)
+	}
+	if err := services.ValidateSchedule(schedule); err != nil {
+		return err
+	}
+	if err := models.ValidateModes(schedule.Modes); err != nil {
+		return err
+	}
+	if err := serial.ValidateRuleActions(schedule.Actions); err != nil {
+		return err
+	}
+
+	schedule.NextRunAt = services.NextRun(schedule, time.Now())
+	if schedule.NextRunAt == nil {
+		return fmt.Errorf("schedule never runs")
+	}
+	return nil
+}
+
+// GetSchedules returns all schedules with their next and last runs
+func (h *Handlers) GetSchedules(c *gin.Context) {
+	schedules, err := h.scheduleService.GetSchedules(h.deviceScope(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if schedules == nil {
+		schedules = []models.Schedule{}
+	}
+	c.JSON(http.StatusOK, schedules)
+}
+
+// GetSchedule returns a schedule
+func (h *Handlers) GetSchedule(c *gin.Context) {
+	schedule, ok := h.schedule(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// CreateSchedule creates a schedule from a cron expression or a one-shot time
+func (h *Handlers) CreateSchedule(c *gin.Context) {
+	var req scheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule := &models.Schedule{}
+	if err := h.applySchedule(&req, schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.scheduleService.CreateSchedule(schedule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.scheduler.Reload()
+
+	log.Printf("Schedule %s created, next run at %s", schedule.Name, schedule.NextRunAt.Format(time.RFC3339))
+	c.JSON(http.StatusCreated, schedule)
+}
+
+// UpdateSchedule replaces a schedule and recomputes its next run
+func (h *Handlers) UpdateSchedule(c *gin.Context) {
+	schedule, ok := h.schedule(c)
+	if !ok {
+		return
+	}
+
+	var req scheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.applySchedule(&req, schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.scheduleService.UpdateSchedule(schedule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.scheduler.Reload()
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// DeleteSchedule deletes a schedule
+func (h *Handlers) DeleteSchedule(c *gin.Context) {
+	schedule, ok := h.schedule(c)
+	if !ok {
+		return
+	}
+
+	if err := h.scheduleService.DeleteSchedule(schedule.ID.Hex()); err != nil {
+		if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.scheduler.Reload()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule deleted"})
+}
+
+// schedule loads the schedule addressed by the ":id" route parameter
+func (h *Handlers) schedule(c *gin.Context) (*models.Schedule, bool) {
+	schedule, err := h.scheduleService.GetSchedule(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return schedule, true
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/caphefalumi/smart-home/config"
 	"github.com/caphefalumi/smart-home/database"
 	"github.com/caphefalumi/smart-home/handlers"
+	"github.com/caphefalumi/smart-home/models"
 	"github.com/caphefalumi/smart-home/serial"
 	"github.com/caphefalumi/smart-home/services"
 	"github.com/gin-contrib/cors"
@@ -38,10 +39,68 @@ func main() {
 	// Initialize services
 	sensorService := services.NewSensorService(db)
 	ruleService := services.NewRuleService(db)
-	serialService := serial.NewArduinoSerial(sensorService, ruleService)
+	if cfg.HasLocation {
+		ruleService.SetLocation(cfg.Latitude, cfg.Longitude)
+	}
+	if err := ruleService.LoadRules(); err != nil {
+		log.Printf("Failed to load rules: %v", err)
+	}
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	go ruleService.WatchRules(watchCtx)
+	commandService := services.NewCommandService(db)
+	actuatorService := services.NewActuatorService(db)
+	scheduleService := services.NewScheduleService(db)
+	sceneService := services.NewSceneService(db)
+	modeService := services.NewModeService(db)
+	notificationService := services.NewNotificationService(db)
+	if err := modeService.Load(); err != nil {
+		log.Printf("Failed to load house mode: %v", err)
+	}
+	devices := serial.NewRegistry(sensorService, ruleService, commandService, actuatorService, sceneService, modeService, notificationService, serial.DeviceOptions{
+		PreferredProtocol: cfg.ProtocolVersion,
+		TelemetryTimeout:  time.Duration(cfg.TelemetryTimeout) * time.Second,
+		CommandTTL:        time.Duration(cfg.CommandTTL) * time.Second,
+		RestorePolicies:   cfg.RestorePolicies,
+	})
+	if _, err := devices.Add(models.DefaultDeviceID); err != nil {
+		log.Fatalf("Failed to register default device: %v", err)
+	}
+
+	// Connect to the configured boards in the background so the API is
+	// available while the devices are still being found
+	connectCtx, stopConnecting := context.WithCancel(context.Background())
+	defer stopConnecting()
+	if cfg.AutoConnect {
+		deviceConfigs := cfg.Devices
+		if cfg.DevicePort != "" || cfg.DeviceTransport == "sim" {
+			deviceConfigs = append([]config.DeviceConfig{{
+				ID:        models.DefaultDeviceID,
+				Transport: cfg.DeviceTransport,
+				Port:      cfg.DevicePort,
+				BaudRate:  cfg.DeviceBaudRate,
+			}}, deviceConfigs...)
+		}
+
+		for _, deviceConfig := range deviceConfigs {
+			device, ok := devices.Get(deviceConfig.ID)
+			if !ok {
+				var err error
+				if device, err = devices.Add(deviceConfig.ID); err != nil {
+					log.Printf("Failed to register device %s: %v", deviceConfig.ID, err)
+					continue
+				}
+			}
+			go autoConnect(connectCtx, device, deviceConfig)
+		}
+	}
+
+	// Start running schedules
+	scheduler := serial.NewScheduler(devices, scheduleService, modeService)
+	scheduler.Start()
 
 	// Initialize handlers
-	h := handlers.NewHandlers(serialService, sensorService, ruleService)
+	h := handlers.NewHandlers(devices, sensorService, ruleService, commandService, actuatorService, scheduleService, sceneService, modeService, notificationService, scheduler)
 
 	// Setup Gin router
 	r := setupRouter(h)
@@ -71,12 +130,13 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	log.Println("[SHUTDOWN] Disconnecting serial service...")
-	if err := serialService.Disconnect(); err != nil {
-		log.Printf("[SHUTDOWN] Error disconnecting serial: %v", err)
-	} else {
-		log.Println("[SHUTDOWN] Serial service disconnected.")
-	}
+	stopConnecting()
+	stopWatching()
+	scheduler.Stop()
+
+	log.Println("[SHUTDOWN] Disconnecting devices...")
+	devices.DisconnectAll()
+	log.Println("[SHUTDOWN] Devices disconnected.")
 
 	log.Println("[SHUTDOWN] Shutting down HTTP server...")
 	if err := srv.Shutdown(ctx); err != nil {
@@ -89,6 +149,49 @@ func main() {
 	fmt.Println("Server exited")
 }
 
+// autoConnect connects to a configured device, retrying with backoff until
+// it succeeds or ctx is canceled. Once connected the serial supervisor keeps
+// the link alive.
+func autoConnect(ctx context.Context, device *serial.ArduinoSerial, deviceConfig config.DeviceConfig) {
+	backoff := time.Second
+	for {
+		// Someone connected through the API in the meantime
+		if device.GetConnectionStatus().State != serial.StateDisconnected {
+			return
+		}
+
+		err := connectDevice(device, deviceConfig)
+		if err == nil {
+			return
+		}
+		log.Printf("Auto-connect to %s failed: %v (retrying in %v)", deviceConfig.ID, err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// connectDevice resolves the configured device address and connects to it
+func connectDevice(device *serial.ArduinoSerial, deviceConfig config.DeviceConfig) error {
+	address, err := serial.ResolveAddress(deviceConfig.Transport, deviceConfig.Port)
+	if err != nil {
+		return err
+	}
+
+	transport, err := serial.NewTransport(deviceConfig.Transport, address, deviceConfig.BaudRate)
+	if err != nil {
+		return err
+	}
+
+	return device.Connect(transport)
+}
+
 func setupRouter(h *handlers.Handlers) *gin.Engine {
 	r := gin.Default()
 
@@ -112,9 +215,41 @@ func setupRouter(h *handlers.Handlers) *gin.Engine {
 		serial := api.Group("/serial")
 		{
 			serial.GET("/ports", h.ListSerialPorts)
+			serial.GET("/status", h.GetConnectionStatus)
 			serial.POST("/connect", h.ConnectSerial)
 			serial.POST("/disconnect", h.DisconnectSerial)
 			serial.POST("/command", h.SendSerialCommand)
+			serial.GET("/protocol", h.GetProtocolStats)
+			serial.POST("/simulator/scenario", h.SetSimulatorScenario)
+		}
+
+		// Device registry endpoints. Device-scoped routes mirror the legacy
+		// routes below, which address the default device.
+		devices := api.Group("/devices")
+		{
+			devices.GET("", h.ListDevices)
+			devices.POST("", h.AddDevice)
+			devices.DELETE("/:id", h.RemoveDevice)
+			devices.GET("/:id/status", h.GetConnectionStatus)
+			devices.POST("/:id/connect", h.ConnectSerial)
+			devices.POST("/:id/disconnect", h.DisconnectSerial)
+			devices.POST("/:id/command", h.SendSerialCommand)
+			devices.GET("/:id/protocol", h.GetProtocolStats)
+			devices.GET("/:id/sensors/current", h.GetCurrentSensorData)
+			devices.GET("/:id/sensors/history", h.GetSensorHistory)
+			devices.GET("/:id/actuators", h.GetActuatorStates)
+			devices.GET("/:id/actuators/status", h.GetActuatorStatuses)
+			devices.GET("/:id/actuators/history", h.GetActuatorHistory)
+			devices.GET("/:id/actuators/restore-policies", h.GetRestorePolicies)
+			devices.PUT("/:id/actuators/restore-policies", h.SetRestorePolicy)
+			devices.POST("/:id/actuators/sync", h.SyncActuatorState)
+			devices.PUT("/:id/actuators/:name", h.SetActuator)
+			devices.GET("/:id/analytics/statistics", h.GetStatistics)
+			devices.GET("/:id/analytics/trends", h.GetTrends)
+			devices.GET("/:id/alerts", h.GetAlerts)
+			devices.GET("/:id/notifications", h.GetNotifications)
+			devices.GET("/:id/rules", h.GetRules)
+			devices.GET("/:id/commands", h.GetCommands)
 		}
 
 		// Sensor endpoints
@@ -128,6 +263,12 @@ func setupRouter(h *handlers.Handlers) *gin.Engine {
 		{
 			actuators.GET("/states", h.GetActuatorStates)
 			actuators.POST("/sync", h.SyncActuatorState)
+			actuators.GET("/status", h.GetActuatorStatuses)
+			actuators.GET("/history", h.GetActuatorHistory)
+			actuators.GET("/restore-policies", h.GetRestorePolicies)
+			actuators.PUT("/restore-policies", h.SetRestorePolicy)
+			actuators.GET("/catalog", h.ListActuators)
+			actuators.PUT("/:name", h.SetActuator)
 		}
 
 		// Music endpoints
@@ -150,12 +291,51 @@ func setupRouter(h *handlers.Handlers) *gin.Engine {
 		{
 			rules.GET("", h.GetRules)
 			rules.POST("", h.CreateRule)
+			rules.POST("/backtest", h.BacktestRule)
 			rules.PUT("/:id", h.UpdateRule)
 			rules.DELETE("/:id", h.DeleteRule)
 		}
 
+		// Schedule endpoints
+		schedules := api.Group("/schedules")
+		{
+			schedules.GET("", h.GetSchedules)
+			schedules.POST("", h.CreateSchedule)
+			schedules.GET("/:id", h.GetSchedule)
+			schedules.PUT("/:id", h.UpdateSchedule)
+			schedules.DELETE("/:id", h.DeleteSchedule)
+		}
+
+		// Scene endpoints
+		scenes := api.Group("/scenes")
+		{
+			scenes.GET("", h.GetScenes)
+			scenes.POST("", h.CreateScene)
+			scenes.POST("/snapshot", h.SnapshotScene)
+			scenes.GET("/:id", h.GetScene)
+			scenes.PUT("/:id", h.UpdateScene)
+			scenes.DELETE("/:id", h.DeleteScene)
+			scenes.POST("/:id/activate", h.ActivateScene)
+		}
+
+		// House mode endpoints
+		mode := api.Group("/mode")
+		{
+			mode.GET("", h.GetMode)
+			mode.PUT("", h.SetMode)
+			mode.GET("/history", h.GetModeHistory)
+		}
+
+		// Command queue endpoints
+		commands := api.Group("/commands")
+		{
+			commands.GET("", h.GetCommands)
+			commands.DELETE("/:id", h.CancelCommand)
+		}
+
 		// Alerts endpoint
 		api.GET("/alerts", h.GetAlerts)
+		api.GET("/notifications", h.GetNotifications)
 	}
 
 	return r
@@ -1,33 +1,72 @@
 package models
 
 import (
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// DefaultDeviceID identifies the board served by the legacy single-device routes
+const DefaultDeviceID = "default"
+
 // SensorData represents sensor readings from Arduino
 type SensorData struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	DeviceID  string             `bson:"deviceId,omitempty" json:"deviceId,omitempty"`
 	Light     int                `bson:"light" json:"light"`
 	Gas       int                `bson:"gas" json:"gas"`
 	Soil      int                `bson:"soil" json:"soil"`
 	Water     int                `bson:"water" json:"water"`
 	Infrared  int                `bson:"infrared" json:"infrared"`
+	Channels  map[string]float64 `bson:"channels,omitempty" json:"channels,omitempty"`
 	Timestamp time.Time          `bson:"timestamp" json:"timestamp"`
 	Alerts    []string           `bson:"alerts,omitempty" json:"alerts,omitempty"`
 }
 
 // SensorReading represents real-time sensor data from Arduino
 type SensorReading struct {
-	Gas       int       `json:"gas"`
-	Light     int       `json:"light"`
-	Soil      int       `json:"soil"`
-	Water     int       `json:"water"`
-	Infrar    int       `json:"infrar"`
-	Btn1      int       `json:"btn1"`
-	Btn2      int       `json:"btn2"`
-	Timestamp time.Time `json:"timestamp"`
+	Gas       int                `json:"gas"`
+	Light     int                `json:"light"`
+	Soil      int                `json:"soil"`
+	Water     int                `json:"water"`
+	Infrar    int                `json:"infrar"`
+	Btn1      int                `json:"btn1"`
+	Btn2      int                `json:"btn2"`
+	Channels  map[string]float64 `json:"channels,omitempty"`
+	Timestamp time.Time          `json:"timestamp"`
+}
+
+// SetChannel records the value of a sensor without a dedicated field
+func (r *SensorReading) SetChannel(name string, value float64) {
+	if r.Channels == nil {
+		r.Channels = make(map[string]float64)
+	}
+	r.Channels[name] = value
+}
+
+// Value returns a sensor or button value by name, falling back to channels
+func (r *SensorReading) Value(name string) (float64, bool) {
+	switch name {
+	case "gas":
+		return float64(r.Gas), true
+	case "light":
+		return float64(r.Light), true
+	case "soil":
+		return float64(r.Soil), true
+	case "water":
+		return float64(r.Water), true
+	case "infrar":
+		return float64(r.Infrar), true
+	case "btn1":
+		return float64(r.Btn1), true
+	case "btn2":
+		return float64(r.Btn2), true
+	}
+	value, ok := r.Channels[name]
+	return value, ok
 }
 
 // ActuatorStates represents the current state of all actuators
@@ -42,20 +81,554 @@ type ActuatorStates struct {
 	Buzzer      bool `json:"buzzer"`
 }
 
-// Rule represents automation rules
+// Value returns an actuator state by field name. Switches are 1 when on.
+func (s *ActuatorStates) Value(field string) (float64, bool) {
+	flag := func(on bool) float64 {
+		if on {
+			return 1
+		}
+		return 0
+	}
+
+	switch field {
+	case "white_light":
+		return flag(s.WhiteLight), true
+	case "yellow_light":
+		return flag(s.YellowLight), true
+	case "relay":
+		return flag(s.Relay), true
+	case "fan":
+		return flag(s.Fan), true
+	case "buzzer":
+		return flag(s.Buzzer), true
+	case "door_angle":
+		return float64(s.DoorAngle), true
+	case "window_angle":
+		return float64(s.WindowAngle), true
+	case "fan_speed":
+		return float64(s.FanSpeed), true
+	}
+	return 0, false
+}
+
+// ActuatorStatus tracks what was requested of an actuator field and what the
+// board last confirmed. Switches use 1 for on and 0 for off.
+type ActuatorStatus struct {
+	Desired     *int       `json:"desired"`
+	Reported    *int       `json:"reported"`
+	RequestedAt *time.Time `json:"requestedAt,omitempty"`
+	ConfirmedAt *time.Time `json:"confirmedAt,omitempty"`
+	Resends     int        `json:"resends"`
+	Unconfirmed bool       `json:"unconfirmed"`
+}
+
+// InSync reports whether the board confirmed the desired value
+func (s *ActuatorStatus) InSync() bool {
+	return s.Desired == nil || (s.Reported != nil && *s.Reported == *s.Desired)
+}
+
+// Actuator change origins
+const (
+	OriginUser       = "user"
+	OriginRule       = "rule"
+	OriginSchedule   = "schedule"
+	OriginButton     = "button"
+	OriginDevice     = "device"
+	OriginReconciler = "reconciler"
+	OriginRestore    = "restore"
+	OriginScene      = "scene"
+)
+
+// Origin identifies who or what issued a command, e.g. a user or a rule ID
+type Origin struct {
+	Kind string `bson:"kind" json:"kind"`
+	ID   string `bson:"id,omitempty" json:"id,omitempty"`
+}
+
+// ActuatorEvent records a change of an actuator state reported by a device
+type ActuatorEvent struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	DeviceID  string             `bson:"deviceId" json:"deviceId"`
+	Actuator  string             `bson:"actuator" json:"actuator"`
+	OldValue  *int               `bson:"oldValue" json:"oldValue"`
+	NewValue  int                `bson:"newValue" json:"newValue"`
+	Command   string             `bson:"command,omitempty" json:"command,omitempty"`
+	Origin    Origin             `bson:"origin" json:"origin"`
+	Timestamp time.Time          `bson:"timestamp" json:"timestamp"`
+}
+
+// Notification is a message recorded by a notify action
+type Notification struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	DeviceID  string             `bson:"deviceId" json:"deviceId"`
+	Message   string             `bson:"message" json:"message"`
+	Origin    Origin             `bson:"origin" json:"origin"`
+	Timestamp time.Time          `bson:"timestamp" json:"timestamp"`
+}
+
+// TriggeredAction is the action sequence of a rule that fired
+type TriggeredAction struct {
+	RuleID  string
+	Actions []RuleAction
+}
+
+// Rule action types
+const (
+	ActionCommand     = "command"      // send a firmware command or set an actuator
+	ActionDelay       = "delay"        // wait before the next step
+	ActionNotify      = "notify"       // record an alert message
+	ActionMelody      = "melody"       // play a song on the buzzer
+	ActionEnableRule  = "enable_rule"  // enable another rule
+	ActionDisableRule = "disable_rule" // disable another rule
+	ActionScene       = "scene"        // activate a scene
+	ActionSetMode     = "set_mode"     // switch the house mode
+)
+
+// Step error handling of rule actions
+const (
+	OnErrorAbort    = "abort"    // stop the sequence (default)
+	OnErrorContinue = "continue" // go on with the next step
+)
+
+// RuleAction is one step of a rule's action sequence. Command steps give
+// either a raw Command such as "fan_speed=180" or an Actuator with one of
+// On, Angle or Speed. Steps with Modes are skipped in other house modes.
+type RuleAction struct {
+	Type     string   `bson:"type" json:"type"`
+	Command  string   `bson:"command,omitempty" json:"command,omitempty"`
+	Actuator string   `bson:"actuator,omitempty" json:"actuator,omitempty"`
+	On       *bool    `bson:"on,omitempty" json:"on,omitempty"`
+	Angle    *int     `bson:"angle,omitempty" json:"angle,omitempty"`
+	Speed    *int     `bson:"speed,omitempty" json:"speed,omitempty"`
+	DelayMs  int      `bson:"delayMs,omitempty" json:"delayMs,omitempty"`
+	Message  string   `bson:"message,omitempty" json:"message,omitempty"`
+	Melody   string   `bson:"melody,omitempty" json:"melody,omitempty"`
+	RuleID   string   `bson:"ruleId,omitempty" json:"ruleId,omitempty"`
+	SceneID  string   `bson:"sceneId,omitempty" json:"sceneId,omitempty"`
+	Mode     string   `bson:"mode,omitempty" json:"mode,omitempty"`
+	Modes    []string `bson:"modes,omitempty" json:"modes,omitempty"`
+	OnError  string   `bson:"onError,omitempty" json:"onError,omitempty"`
+}
+
+// House modes
+const (
+	ModeHome     = "home"
+	ModeAway     = "away"
+	ModeNight    = "night"
+	ModeVacation = "vacation"
+)
+
+// houseModes are the valid house modes
+var houseModes = map[string]bool{ModeHome: true, ModeAway: true, ModeNight: true, ModeVacation: true}
+
+// ValidateMode checks that mode is a house mode
+func ValidateMode(mode string) error {
+	if !houseModes[mode] {
+		return fmt.Errorf("invalid mode %q, expected home, away, night or vacation", mode)
+	}
+	return nil
+}
+
+// ValidateModes checks a list of house modes that scopes a rule, schedule or
+// action step
+func ValidateModes(modes []string) error {
+	for _, mode := range modes {
+		if err := ValidateMode(mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InModes reports whether mode is allowed by a list of house modes. An empty
+// list allows every mode.
+func InModes(modes []string, mode string) bool {
+	if len(modes) == 0 {
+		return true
+	}
+	for _, m := range modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// ModeChange records a switch of the house mode
+type ModeChange struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	Mode      string             `bson:"mode" json:"mode"`
+	Previous  string             `bson:"previous" json:"previous"`
+	Origin    Origin             `bson:"origin" json:"origin"`
+	Timestamp time.Time          `bson:"timestamp" json:"timestamp"`
+}
+
+// conditionOperators are the comparisons a condition may use
+var conditionOperators = map[string]bool{">": true, "<": true, ">=": true, "<=": true, "==": true, "!=": true}
+
+// signalNamePattern matches sensor and channel names
+var signalNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Statistics a sensor comparison can apply over a window of recent readings
+const (
+	StatDelta     = "delta"     // latest value minus the oldest in the window
+	StatSlope     = "slope"     // least-squares trend, per minute
+	StatAverage   = "avg"       // moving average
+	StatDeviation = "deviation" // latest value minus the average of the earlier readings
+)
+
+// MaxStatWindow is the longest window a statistic can cover, in seconds
+const MaxStatWindow = 3600
+
+// Condition is a node of a rule's condition tree. A node is either a group
+// whose children must all (And) or partly (Or) hold, or a comparison of a
+// sensor, button or channel value, or of an actuator state, with Value.
+// Sensor comparisons may apply a Stat over the last Window seconds instead
+// of using the latest value.
+type Condition struct {
+	And      []Condition `bson:"and,omitempty" json:"and,omitempty"`
+	Or       []Condition `bson:"or,omitempty" json:"or,omitempty"`
+	Sensor   string      `bson:"sensor,omitempty" json:"sensor,omitempty"`
+	Actuator string      `bson:"actuator,omitempty" json:"actuator,omitempty"`
+	Stat     string      `bson:"stat,omitempty" json:"stat,omitempty"`
+	Window   int         `bson:"window,omitempty" json:"window,omitempty"`
+	Operator string      `bson:"operator,omitempty" json:"operator,omitempty"`
+	Value    float64     `bson:"value,omitempty" json:"value,omitempty"`
+}
+
+// Validate checks that every node of the tree is a well-formed group or comparison
+func (c *Condition) Validate() error {
+	kinds := 0
+	for _, set := range []bool{c.And != nil, c.Or != nil, c.Sensor != "", c.Actuator != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return fmt.Errorf("a condition needs exactly one of and, or, sensor or actuator")
+	}
+
+	if c.And != nil || c.Or != nil {
+		children := c.And
+		if c.Or != nil {
+			children = c.Or
+		}
+		if len(children) == 0 {
+			return fmt.Errorf("condition groups must not be empty")
+		}
+		for i := range children {
+			if err := children[i].Validate(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if c.Sensor != "" && !signalNamePattern.MatchString(c.Sensor) {
+		return fmt.Errorf("invalid sensor name %q", c.Sensor)
+	}
+	if c.Actuator != "" {
+		if _, ok := (&ActuatorStates{}).Value(c.Actuator); !ok {
+			return fmt.Errorf("unknown actuator %q", c.Actuator)
+		}
+	}
+	if !conditionOperators[c.Operator] {
+		return fmt.Errorf("invalid operator %q", c.Operator)
+	}
+
+	switch c.Stat {
+	case "":
+		if c.Window != 0 {
+			return fmt.Errorf("window needs a stat")
+		}
+	case StatDelta, StatSlope, StatAverage, StatDeviation:
+		if c.Sensor == "" {
+			return fmt.Errorf("%s applies to sensors only", c.Stat)
+		}
+		if c.Window <= 0 || c.Window > MaxStatWindow {
+			return fmt.Errorf("window must be between 1 and %d seconds", MaxStatWindow)
+		}
+	default:
+		return fmt.Errorf("unknown stat %q", c.Stat)
+	}
+	return nil
+}
+
+// String renders the condition, e.g. "(gas > 500 AND window_angle == 0)"
+func (c *Condition) String() string {
+	join := func(children []Condition, op string) string {
+		parts := make([]string, len(children))
+		for i := range children {
+			parts[i] = children[i].String()
+		}
+		return "(" + strings.Join(parts, " "+op+" ") + ")"
+	}
+
+	switch {
+	case c.And != nil:
+		return join(c.And, "AND")
+	case c.Or != nil:
+		return join(c.Or, "OR")
+	case c.Actuator != "":
+		return fmt.Sprintf("%s %s %g", c.Actuator, c.Operator, c.Value)
+	case c.Stat != "":
+		return fmt.Sprintf("%s(%s, %ds) %s %g", c.Stat, c.Sensor, c.Window, c.Operator, c.Value)
+	}
+	return fmt.Sprintf("%s %s %g", c.Sensor, c.Operator, c.Value)
+}
+
+// Weekdays accepted in active windows
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// dateLayout is the format of window dates
+const dateLayout = "2006-01-02"
+
+// ActiveWindow is a period in which a rule is evaluated. From and To are
+// "HH:MM" times or "sunrise"/"sunset" with an optional offset such as
+// "sunset-30m", and may wrap past midnight. Days ("mon".."sun") and the
+// StartDate/EndDate range ("YYYY-MM-DD") apply to the day the window opens.
+// Empty fields do not restrict the window.
+type ActiveWindow struct {
+	Days      []string `bson:"days,omitempty" json:"days,omitempty"`
+	From      string   `bson:"from,omitempty" json:"from,omitempty"`
+	To        string   `bson:"to,omitempty" json:"to,omitempty"`
+	StartDate string   `bson:"startDate,omitempty" json:"startDate,omitempty"`
+	EndDate   string   `bson:"endDate,omitempty" json:"endDate,omitempty"`
+}
+
+// TimeOfDay is a parsed window boundary: a fixed time in minutes after
+// midnight, or a sun event plus an offset
+type TimeOfDay struct {
+	Sun     string // "sunrise", "sunset" or empty for a fixed time
+	Minutes int
+	Offset  time.Duration
+}
+
+// ParseTimeOfDay parses a window boundary such as "18:30" or "sunrise+1h"
+func ParseTimeOfDay(spec string) (TimeOfDay, error) {
+	for _, sun := range []string{"sunrise", "sunset"} {
+		if !strings.HasPrefix(spec, sun) {
+			continue
+		}
+		offset := spec[len(sun):]
+		if offset == "" {
+			return TimeOfDay{Sun: sun}, nil
+		}
+		if offset[0] != '+' && offset[0] != '-' {
+			break
+		}
+		duration, err := time.ParseDuration(offset)
+		if err != nil {
+			return TimeOfDay{}, fmt.Errorf("invalid offset in %q", spec)
+		}
+		return TimeOfDay{Sun: sun, Offset: duration}, nil
+	}
+
+	t, err := time.Parse("15:04", spec)
+	if err != nil {
+		return TimeOfDay{}, fmt.Errorf("invalid time %q, expected HH:MM, sunrise or sunset", spec)
+	}
+	return TimeOfDay{Minutes: t.Hour()*60 + t.Minute()}, nil
+}
+
+// Validate checks the days, times and dates of the window
+func (w *ActiveWindow) Validate() error {
+	for _, day := range w.Days {
+		if _, ok := weekdays[day]; !ok {
+			return fmt.Errorf("invalid day %q", day)
+		}
+	}
+	for _, spec := range []string{w.From, w.To} {
+		if spec == "" {
+			continue
+		}
+		if _, err := ParseTimeOfDay(spec); err != nil {
+			return err
+		}
+	}
+	for _, date := range []string{w.StartDate, w.EndDate} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(dateLayout, date); err != nil {
+			return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+		}
+	}
+	if w.StartDate != "" && w.EndDate != "" && w.StartDate > w.EndDate {
+		return fmt.Errorf("startDate is after endDate")
+	}
+	return nil
+}
+
+// UsesSun reports whether a boundary of the window is a sun event
+func (w *ActiveWindow) UsesSun() bool {
+	return strings.HasPrefix(w.From, "sun") || strings.HasPrefix(w.To, "sun")
+}
+
+// OpensOn reports whether the window may open on the day of t, by weekday
+// and date range
+func (w *ActiveWindow) OpensOn(t time.Time) bool {
+	if len(w.Days) > 0 {
+		match := false
+		for _, day := range w.Days {
+			if weekdays[day] == t.Weekday() {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+
+	date := t.Format(dateLayout)
+	if w.StartDate != "" && date < w.StartDate {
+		return false
+	}
+	if w.EndDate != "" && date > w.EndDate {
+		return false
+	}
+	return true
+}
+
+// Rule represents automation rules. Rules either have a Condition tree or
+// the single Sensor/Operator/Threshold comparison of earlier versions, and
+// either an Actions sequence or a single raw Action command.
+//
+// A rule that sets ForSeconds, ForSamples, ClearCondition or ClearActions
+// latches: it fires once the condition has held for the given time and
+// number of readings, then stays active until ClearCondition holds (or, by
+// default, the condition stops holding) and runs ClearActions.
+//
+// Rules with Windows are only evaluated inside one of them, and rules with
+// Modes only in one of those house modes.
 type Rule struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	Name           string             `bson:"name" json:"name"`
+	DeviceID       string             `bson:"deviceId,omitempty" json:"deviceId,omitempty"`
+	Condition      *Condition         `bson:"condition,omitempty" json:"condition,omitempty"`
+	Sensor         string             `bson:"sensor" json:"sensor"`
+	Operator       string             `bson:"operator" json:"operator"`
+	Threshold      int                `bson:"threshold" json:"threshold"`
+	ForSeconds     int                `bson:"forSeconds,omitempty" json:"forSeconds,omitempty"`
+	ForSamples     int                `bson:"forSamples,omitempty" json:"forSamples,omitempty"`
+	ClearCondition *Condition         `bson:"clearCondition,omitempty" json:"clearCondition,omitempty"`
+	Action         string             `bson:"action,omitempty" json:"action,omitempty"`
+	Actions        []RuleAction       `bson:"actions,omitempty" json:"actions,omitempty"`
+	ClearActions   []RuleAction       `bson:"clearActions,omitempty" json:"clearActions,omitempty"`
+	Windows        []ActiveWindow     `bson:"windows,omitempty" json:"windows,omitempty"`
+	Modes          []string           `bson:"modes,omitempty" json:"modes,omitempty"`
+	InWindow       *bool              `bson:"-" json:"inWindow,omitempty"` // set when rules are served
+	Enabled        bool               `bson:"enabled" json:"enabled"`
+	Description    string             `bson:"description,omitempty" json:"description,omitempty"`
+	CreatedAt      time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt      time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Scene is a named target state for a subset of actuators. States maps
+// fields of ActuatorStates, such as "white_light" or "door_angle", to their
+// value, with switches as 1 or 0.
+type Scene struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
 	Name        string             `bson:"name" json:"name"`
-	Sensor      string             `bson:"sensor" json:"sensor"`
-	Operator    string             `bson:"operator" json:"operator"`
-	Threshold   int                `bson:"threshold" json:"threshold"`
-	Action      string             `bson:"action" json:"action"`
-	Enabled     bool               `bson:"enabled" json:"enabled"`
 	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	States      map[string]int     `bson:"states" json:"states"`
 	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
 	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"`
 }
 
+// Schedule missed-run policies, applied to runs that fell due while the
+// server was down
+const (
+	MissedSkip = "skip" // record the run as missed and wait for the next one
+	MissedRun  = "run"  // run once as soon as possible
+)
+
+// Schedule run outcomes
+const (
+	RunOK      = "ok"
+	RunFailed  = "failed"
+	RunMissed  = "missed"
+	RunSkipped = "skipped" // due outside the schedule's house modes
+)
+
+// Schedule runs an action sequence on a device at the times of a cron
+// expression, or once at a given time. Schedules with Modes only run in one
+// of those house modes.
+type Schedule struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	Name       string             `bson:"name" json:"name"`
+	DeviceID   string             `bson:"deviceId" json:"deviceId"`
+	Cron       string             `bson:"cron,omitempty" json:"cron,omitempty"`
+	At         *time.Time         `bson:"at,omitempty" json:"at,omitempty"`
+	Actions    []RuleAction       `bson:"actions" json:"actions"`
+	MissedRun  string             `bson:"missedRun" json:"missedRun"`
+	Modes      []string           `bson:"modes,omitempty" json:"modes,omitempty"`
+	Enabled    bool               `bson:"enabled" json:"enabled"`
+	NextRunAt  *time.Time         `bson:"nextRunAt,omitempty" json:"nextRunAt,omitempty"`
+	LastRunAt  *time.Time         `bson:"lastRunAt,omitempty" json:"lastRunAt,omitempty"`
+	LastResult string             `bson:"lastResult,omitempty" json:"lastResult,omitempty"`
+	LastError  string             `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt  time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Persisted command statuses
+const (
+	CommandPending    = "pending"
+	CommandSent       = "sent"
+	CommandAcked      = "acked"
+	CommandFailed     = "failed"
+	CommandExpired    = "expired"
+	CommandCanceled   = "canceled"
+	CommandSuperseded = "superseded"
+)
+
+// Command represents a command queued for a device
+type Command struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	DeviceID  string             `bson:"deviceId" json:"deviceId"`
+	Command   string             `bson:"command" json:"command"`
+	Priority  int                `bson:"priority" json:"priority"`
+	Origin    Origin             `bson:"origin" json:"origin"`
+	Status    string             `bson:"status" json:"status"`
+	Reply     string             `bson:"reply,omitempty" json:"reply,omitempty"`
+	Attempts  int                `bson:"attempts" json:"attempts"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// EffectiveCondition returns the rule's condition tree, converting a
+// single-comparison rule into one
+func (r *Rule) EffectiveCondition() *Condition {
+	if r.Condition != nil {
+		return r.Condition
+	}
+	return &Condition{Sensor: r.Sensor, Operator: r.Operator, Value: float64(r.Threshold)}
+}
+
+// Latches reports whether the rule fires once per episode rather than
+// repeatedly while its condition holds
+func (r *Rule) Latches() bool {
+	return r.ForSeconds > 0 || r.ForSamples > 0 || r.ClearCondition != nil || len(r.ClearActions) > 0
+}
+
+// EffectiveActions returns the rule's action sequence, converting a single
+// Action command into one
+func (r *Rule) EffectiveActions() []RuleAction {
+	if len(r.Actions) > 0 {
+		return r.Actions
+	}
+	if r.Action == "" {
+		return nil
+	}
+	return []RuleAction{{Type: ActionCommand, Command: r.Action}}
+}
+
 // Statistics represents sensor statistics
 type Statistics struct {
 	LightMean float64 `json:"light_mean,omitempty"`
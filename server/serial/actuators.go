@@ -0,0 +1,254 @@
+package serial
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/caphefalumi/smart-home/models"
+)
+
+// Actuator kinds
+const (
+	ActuatorSwitch = "switch" // on/off
+	ActuatorServo  = "servo"  // angle 0-180
+	ActuatorPWM    = "pwm"    // on/off and speed 0-255
+)
+
+// Actuator describes an output driven by the firmware
+type Actuator struct {
+	Name        string `json:"name"`
+	Kind        string `json:"kind"`
+	Min         int    `json:"min"`
+	Max         int    `json:"max"`
+	onCommand   string
+	offCommand  string
+	valuePrefix string
+}
+
+// ActuatorSetting is a requested actuator value. Exactly one field is set:
+// On for switches and PWM outputs, Angle for servos, Speed for PWM outputs.
+type ActuatorSetting struct {
+	On    *bool `json:"on,omitempty"`
+	Angle *int  `json:"angle,omitempty"`
+	Speed *int  `json:"speed,omitempty"`
+}
+
+// actuators is the catalogue of outputs supported by smarthome.ino
+var actuators = map[string]Actuator{
+	"white_light":  {Name: "white_light", Kind: ActuatorSwitch, Max: 1, onCommand: "white_light_on", offCommand: "white_light_off"},
+	"yellow_light": {Name: "yellow_light", Kind: ActuatorSwitch, Max: 1, onCommand: "yellow_light_on", offCommand: "yellow_light_off"},
+	"relay":        {Name: "relay", Kind: ActuatorSwitch, Max: 1, onCommand: "relay_on", offCommand: "relay_off"},
+	"buzzer":       {Name: "buzzer", Kind: ActuatorSwitch, Max: 1, onCommand: "buzzer_on", offCommand: "buzzer_off"},
+	"door":         {Name: "door", Kind: ActuatorServo, Max: 180, valuePrefix: "door_angle="},
+	"window":       {Name: "window", Kind: ActuatorServo, Max: 180, valuePrefix: "window_angle="},
+	"fan":          {Name: "fan", Kind: ActuatorPWM, Max: 255, onCommand: "fan_on", offCommand: "fan_off", valuePrefix: "fan_speed="},
+}
+
+// plainCommands are firmware commands outside the actuator catalogue
+var plainCommands = map[string]bool{
+	"door_open":       true,
+	"door_close":      true,
+	"window_open":     true,
+	"window_close":    true,
+	"play_birthday":   true,
+	"play_ode_to_joy": true,
+	"stop_music":      true,
+}
+
+// GetActuator returns the catalogue entry of an actuator
+func GetActuator(name string) (Actuator, bool) {
+	actuator, ok := actuators[name]
+	return actuator, ok
+}
+
+// ListActuators returns the actuator catalogue sorted by name
+func ListActuators() []Actuator {
+	list := make([]Actuator, 0, len(actuators))
+	for _, actuator := range actuators {
+		list = append(list, actuator)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Command validates a setting and renders the command that applies it
+func (a Actuator) Command(setting ActuatorSetting) (string, error) {
+	set := 0
+	for _, field := range []bool{setting.On != nil, setting.Angle != nil, setting.Speed != nil} {
+		if field {
+			set++
+		}
+	}
+	if set != 1 {
+		return "", fmt.Errorf("exactly one of on, angle or speed must be given for %s", a.Name)
+	}
+
+	switch {
+	case setting.On != nil && a.onCommand != "":
+		if *setting.On {
+			return a.onCommand, nil
+		}
+		return a.offCommand, nil
+	case setting.Angle != nil && a.Kind == ActuatorServo:
+		return a.valueCommand(*setting.Angle)
+	case setting.Speed != nil && a.Kind == ActuatorPWM:
+		return a.valueCommand(*setting.Speed)
+	}
+	return "", fmt.Errorf("%s (%s) does not accept this setting", a.Name, a.Kind)
+}
+
+// valueCommand renders a parameterised command after checking its range
+func (a Actuator) valueCommand(value int) (string, error) {
+	if value < a.Min || value > a.Max {
+		return "", fmt.Errorf("%s value %d out of range %d-%d", a.Name, value, a.Min, a.Max)
+	}
+	return a.valuePrefix + strconv.Itoa(value), nil
+}
+
+// ValidateCommand checks that a raw command is one the firmware accepts, with
+// parameters in range
+func ValidateCommand(command string) error {
+	if plainCommands[command] {
+		return nil
+	}
+
+	for _, actuator := range actuators {
+		if command == actuator.onCommand || command == actuator.offCommand {
+			return nil
+		}
+		if actuator.valuePrefix == "" || !strings.HasPrefix(command, actuator.valuePrefix) {
+			continue
+		}
+		value, err := strconv.Atoi(command[len(actuator.valuePrefix):])
+		if err != nil {
+			return fmt.Errorf("invalid value in command %q", command)
+		}
+		_, err = actuator.valueCommand(value)
+		return err
+	}
+
+	return fmt.Errorf("unknown command %q", command)
+}
+
+// presetCommands set a state field to a fixed value
+var presetCommands = map[string]struct {
+	field string
+	value int
+}{
+	"door_open":    {"door_angle", 180},
+	"door_close":   {"door_angle", 0},
+	"window_open":  {"window_angle", 180},
+	"window_close": {"window_angle", 0},
+}
+
+// commandState returns the field of ActuatorStates a command sets and the
+// value it sets it to
+func commandState(command string) (string, int, bool) {
+	if preset, ok := presetCommands[command]; ok {
+		return preset.field, preset.value, true
+	}
+
+	for _, actuator := range actuators {
+		switch {
+		case actuator.onCommand != "" && command == actuator.onCommand:
+			return actuator.Name, 1, true
+		case actuator.offCommand != "" && command == actuator.offCommand:
+			return actuator.Name, 0, true
+		case actuator.valuePrefix != "" && strings.HasPrefix(command, actuator.valuePrefix):
+			value, err := strconv.Atoi(command[len(actuator.valuePrefix):])
+			if err != nil {
+				return "", 0, false
+			}
+			return strings.TrimSuffix(actuator.valuePrefix, "="), value, true
+		}
+	}
+	return "", 0, false
+}
+
+// stateCommand renders the command that sets a field of ActuatorStates
+func stateCommand(field string, value int) (string, bool) {
+	if actuator, ok := actuators[field]; ok && actuator.onCommand != "" {
+		if value != 0 {
+			return actuator.onCommand, true
+		}
+		return actuator.offCommand, true
+	}
+
+	for _, actuator := range actuators {
+		if actuator.valuePrefix == field+"=" {
+			return actuator.valuePrefix + strconv.Itoa(value), true
+		}
+	}
+	return "", false
+}
+
+// setStateField stores a value in the matching field of ActuatorStates
+func setStateField(states *models.ActuatorStates, field string, value int) {
+	switch field {
+	case "white_light":
+		states.WhiteLight = value != 0
+	case "yellow_light":
+		states.YellowLight = value != 0
+	case "relay":
+		states.Relay = value != 0
+	case "buzzer":
+		states.Buzzer = value != 0
+	case "fan":
+		states.Fan = value != 0
+	case "fan_speed":
+		states.FanSpeed = value
+	case "door_angle":
+		states.DoorAngle = value
+	case "window_angle":
+		states.WindowAngle = value
+	}
+}
+
+// stateFields maps the fields of ActuatorStates to their actuator
+var stateFields = map[string]string{
+	"white_light":  "white_light",
+	"yellow_light": "yellow_light",
+	"relay":        "relay",
+	"buzzer":       "buzzer",
+	"fan":          "fan",
+	"door_angle":   "door",
+	"window_angle": "window",
+	"fan_speed":    "fan",
+}
+
+// ParseStateField converts a value for a field of ActuatorStates, such as
+// "fan" or "door_angle", into a setting of its actuator
+func ParseStateField(field string, value interface{}) (string, ActuatorSetting, error) {
+	name, ok := stateFields[field]
+	if !ok {
+		return "", ActuatorSetting{}, fmt.Errorf("unknown actuator %q", field)
+	}
+
+	var setting ActuatorSetting
+	switch field {
+	case "door_angle", "window_angle", "fan_speed":
+		number, ok := value.(float64)
+		if !ok || number != float64(int(number)) {
+			return "", ActuatorSetting{}, fmt.Errorf("%s must be an integer", field)
+		}
+		n := int(number)
+		if field == "fan_speed" {
+			setting.Speed = &n
+		} else {
+			setting.Angle = &n
+		}
+	default:
+		on, ok := value.(bool)
+		if !ok {
+			return "", ActuatorSetting{}, fmt.Errorf("%s must be a boolean", field)
+		}
+		setting.On = &on
+	}
+
+	if _, err := actuators[name].Command(setting); err != nil {
+		return "", ActuatorSetting{}, err
+	}
+	return name, setting, nil
+}
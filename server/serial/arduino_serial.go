@@ -3,9 +3,7 @@ package serial
 import (
 	"bufio"
 	"fmt"
-	"io"
 	"log"
-	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -13,125 +11,179 @@ import (
 
 	"github.com/caphefalumi/smart-home/models"
 	"github.com/caphefalumi/smart-home/services"
-	"github.com/tarm/serial"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // ArduinoSerial handles serial communication with Arduino
 type ArduinoSerial struct {
-	port           io.ReadWriteCloser
-	isConnected    bool
-	currentData    *models.SensorReading
-	actuatorStates *models.ActuatorStates
-	dataBuffer     []models.SensorData
-	sensorService  *services.SensorService
-	ruleService    *services.RuleService
-	commandQueue   []string
-	isReady        bool
-	mutex          sync.RWMutex
-	stopChan       chan bool
-	saveInterval   time.Duration
-	wg             sync.WaitGroup
+	id                  string
+	transport           Transport
+	state               string
+	currentData         *models.SensorReading
+	pendingChannels     map[string]float64 // channels reported without a full reading
+	signals             *services.SignalHistory
+	actuatorStates      *models.ActuatorStates
+	actuatorStatuses    map[string]*models.ActuatorStatus
+	dataBuffer          []models.SensorData
+	sensorService       *services.SensorService
+	ruleService         *services.RuleService
+	commandService      commandStore
+	actuatorService     *services.ActuatorService
+	sceneService        *services.SceneService
+	modeService         *services.ModeService
+	notificationService *services.NotificationService
+	modeButtons         buttonGesture
+	actuatorEvents      []models.ActuatorEvent
+	commandMutex        sync.Mutex // orders persisting commands against restoring them
+	commandQueue        []*pendingCommand
+	inFlight            *pendingCommand
+	queueSignal         chan struct{}
+	replies             chan deviceReply
+	nextCommandID       int
+	ackTimeout          time.Duration
+	retryBackoff        time.Duration
+	maxRetries          int
+	commandTTL          time.Duration
+	musicPlaying        bool
+	reconcileInterval   time.Duration
+	reconcileGrace      time.Duration
+	maxResends          int
+	restorePolicies     map[string]string
+	protocolStats       ProtocolStats
+	preferredProtocol   int
+	lastRxSeq           int
+	txSeq               int
+	mutex               sync.RWMutex
+	stopChan            chan bool
+	supervisorStop      chan bool
+	linkLost            chan string
+	stateSince          time.Time
+	transitions         []StateTransition
+	lastTelemetry       time.Time
+	telemetryTimeout    time.Duration
+	reconnectAttempts   int
+	reconnectBackoff    time.Duration
+	maxReconnectBackoff time.Duration
+	saveInterval        time.Duration
+	wg                  sync.WaitGroup
+	supervisorWg        sync.WaitGroup
 }
 
 // NewArduinoSerial creates a new Arduino serial handler
-func NewArduinoSerial(sensorService *services.SensorService, ruleService *services.RuleService) *ArduinoSerial {
-	return &ArduinoSerial{
-		actuatorStates: &models.ActuatorStates{},
-		dataBuffer:     make([]models.SensorData, 0),
-		sensorService:  sensorService,
-		ruleService:    ruleService,
-		commandQueue:   make([]string, 0),
-		isReady:        true,
-		stopChan:       make(chan bool),
-		saveInterval:   2 * time.Second,
-	}
+func NewArduinoSerial(id string, sensorService *services.SensorService, ruleService *services.RuleService, commandService *services.CommandService, actuatorService *services.ActuatorService, sceneService *services.SceneService, modeService *services.ModeService, notificationService *services.NotificationService) *ArduinoSerial {
+	a := &ArduinoSerial{
+		id:                  id,
+		signals:             services.NewSignalHistory(),
+		actuatorStates:      &models.ActuatorStates{},
+		actuatorStatuses:    make(map[string]*models.ActuatorStatus),
+		dataBuffer:          make([]models.SensorData, 0),
+		sensorService:       sensorService,
+		ruleService:         ruleService,
+		commandService:      commandService,
+		actuatorService:     actuatorService,
+		sceneService:        sceneService,
+		modeService:         modeService,
+		notificationService: notificationService,
+		commandQueue:        make([]*pendingCommand, 0),
+		queueSignal:         make(chan struct{}, 1),
+		replies:             make(chan deviceReply, 8),
+		ackTimeout:          3 * time.Second,
+		retryBackoff:        500 * time.Millisecond,
+		maxRetries:          2,
+		commandTTL:          5 * time.Minute,
+		reconcileInterval:   5 * time.Second,
+		reconcileGrace:      15 * time.Second,
+		maxResends:          3,
+		restorePolicies:     make(map[string]string),
+		protocolStats:       ProtocolStats{Version: ProtocolV1},
+		preferredProtocol:   ProtocolV2,
+		lastRxSeq:           -1,
+		state:               StateDisconnected,
+		stopChan:            make(chan bool),
+		linkLost:            make(chan string, 1),
+		telemetryTimeout:    10 * time.Second,
+		reconnectBackoff:    time.Second,
+		maxReconnectBackoff: 30 * time.Second,
+		saveInterval:        2 * time.Second,
+	}
+	for actuator, policy := range defaultRestorePolicies {
+		a.restorePolicies[actuator] = policy
+	}
+	return a
 }
 
-// ListPorts returns available serial ports
-func (a *ArduinoSerial) ListPorts() ([]string, error) {
-	// On Windows, common ports are COM1, COM2, etc.
-	// This is a simplified implementation - in production you'd use a proper port discovery
-	commonPorts := []string{"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9", "COM10"}
-
-	var availablePorts []string
-	for _, portName := range commonPorts {
-		config := &serial.Config{
-			Name:        portName,
-			Baud:        9600,
-			ReadTimeout: time.Millisecond * 100,
-		}
-
-		if port, err := serial.OpenPort(config); err == nil {
-			port.Close()
-			availablePorts = append(availablePorts, portName)
-		}
-	}
-
-	return availablePorts, nil
-}
-
-// Connect establishes connection to Arduino
-func (a *ArduinoSerial) Connect(portName string, baudRate int) error {
+// Connect establishes connection to Arduino over the given transport. The
+// link is supervised and reopened automatically until Disconnect is called.
+func (a *ArduinoSerial) Connect(transport Transport) error {
 	a.mutex.Lock()
-	defer a.mutex.Unlock()
-
-	if a.isConnected {
+	if a.state != StateDisconnected {
+		a.mutex.Unlock()
 		return fmt.Errorf("already connected to a port")
 	}
+	a.setState(StateConnecting, "connect requested")
+	a.mutex.Unlock()
 
-	config := &serial.Config{
-		Name:        portName,
-		Baud:        baudRate,
-		ReadTimeout: time.Second * 5,
+	if err := transport.Open(); err != nil {
+		a.mutex.Lock()
+		a.setState(StateDisconnected, err.Error())
+		a.mutex.Unlock()
+		return err
 	}
 
-	port, err := serial.OpenPort(config)
+	// Wait for Arduino to reset
+	time.Sleep(2 * time.Second)
+
+	// Pick up commands queued while the device was disconnected or before a
+	// restart. Holding commandMutex keeps SendCommand from persisting a
+	// command that would then be missed or queued twice.
+	a.commandMutex.Lock()
+	defer a.commandMutex.Unlock()
+	records, err := a.commandService.RestoreCommands(a.id)
 	if err != nil {
-		return fmt.Errorf("failed to open port %s: %w", portName, err)
+		log.Printf("Failed to restore queued commands: %v", err)
 	}
 
-	a.port = port
-	a.isConnected = true
-
-	// Wait for Arduino to reset
-	time.Sleep(2 * time.Second)
-	// Start data processing goroutines
-	a.wg.Add(2)
-	go a.startDataListener()
-	go a.startDataSaver()
+	a.mutex.Lock()
+	a.transport = transport
+	a.protocolStats = ProtocolStats{}
+	a.reconnectAttempts = 0
+	a.supervisorStop = make(chan bool)
+	a.restoreQueuedCommands(records)
+	a.startSession(transport)
+	a.supervisorWg.Add(1)
+	go a.supervise(transport, a.supervisorStop)
+	a.mutex.Unlock()
 
-	log.Printf("✓ Connected to Arduino on %s", portName)
+	info := transport.Info()
+	log.Printf("✓ Connected to Arduino %s via %s %s", a.id, info.Kind, info.Address)
 	return nil
 }
 
 // Disconnect closes the serial connection
 func (a *ArduinoSerial) Disconnect() error {
 	a.mutex.Lock()
-	defer a.mutex.Unlock()
 
-	if !a.isConnected {
+	switch a.state {
+	case StateDisconnected:
+		a.mutex.Unlock()
 		return nil
+	case StateConnecting:
+		a.mutex.Unlock()
+		return fmt.Errorf("connection in progress")
 	}
 
-	// Signal goroutines to stop
-	select {
-	case <-a.stopChan:
-		// Channel already closed
-	default:
-		close(a.stopChan)
-	}
-
-	// Close the port first to unblock scanner.Scan()
-	if a.port != nil {
-		a.port.Close()
-		a.port = nil
-	}
-
-	a.isConnected = false
+	// Signal the supervisor and session goroutines to stop. Closing the
+	// transport unblocks scanner.Scan().
+	close(a.supervisorStop)
+	a.stopSession()
+	a.transport = nil
+	a.setState(StateDisconnected, "disconnect requested")
+	a.mutex.Unlock()
 
 	// Wait for goroutines to finish with timeout
 	done := make(chan struct{})
 	go func() {
+		a.supervisorWg.Wait()
 		a.wg.Wait()
 		close(done)
 	}()
@@ -143,44 +195,124 @@ func (a *ArduinoSerial) Disconnect() error {
 		log.Println("⚠ Timeout waiting for goroutines to stop")
 	}
 
+	// Commands that never reached the board wait for the next connect
+	a.releaseQueuedCommands()
+
 	// Save any remaining buffered data
 	a.saveBufferedData()
+	a.saveActuatorEvents()
 
 	log.Println("✓ Disconnected from Arduino")
 	return nil
 }
 
+// ID returns the device ID
+func (a *ArduinoSerial) ID() string {
+	return a.id
+}
+
 // IsConnected returns connection status
 func (a *ArduinoSerial) IsConnected() bool {
 	a.mutex.RLock()
 	defer a.mutex.RUnlock()
-	return a.isConnected
+	return a.state == StateConnected
 }
 
-// SendCommand sends a command to Arduino
-func (a *ArduinoSerial) SendCommand(command string) error {
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
+// GetTransportInfo returns the description of the active transport, or nil when disconnected
+func (a *ArduinoSerial) GetTransportInfo() *TransportInfo {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
 
-	if !a.isConnected || a.port == nil {
-		return fmt.Errorf("not connected to Arduino")
+	if a.transport == nil {
+		return nil
 	}
+	info := a.transport.Info()
+	return &info
+}
 
-	if !a.isReady {
-		// Queue the command
-		a.commandQueue = append(a.commandQueue, command)
-		return nil
+// SetSimulatorScenario switches the scenario of a connected simulator
+func (a *ArduinoSerial) SetSimulatorScenario(scenario string) error {
+	a.mutex.RLock()
+	simulator, ok := a.transport.(*Simulator)
+	a.mutex.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("not connected to the simulator")
 	}
+	return simulator.SetScenario(scenario)
+}
 
-	// Send command immediately
-	_, err := a.port.Write([]byte(command + "\n"))
-	if err != nil {
-		return fmt.Errorf("failed to send command: %w", err)
+// SendCommand queues a command for the board and waits until it is
+// acknowledged, rejected or times out. Commands sent while the link is being
+// re-established wait in the queue until it is back.
+func (a *ArduinoSerial) SendCommand(command string) (*CommandResult, error) {
+	return a.SendCommandWithOptions(command, CommandOptions{})
+}
+
+// SendCommandWithOptions queues a command like SendCommand. Unless it is
+// ephemeral the command is persisted first; while the device is disconnected
+// it stays stored and the result has status CommandQueued.
+func (a *ArduinoSerial) SendCommandWithOptions(command string, options CommandOptions) (*CommandResult, error) {
+	a.commandMutex.Lock()
+
+	a.mutex.RLock()
+	ttl := a.commandTTL
+	a.mutex.RUnlock()
+	if options.TTL > 0 {
+		ttl = options.TTL
+	}
+	expiresAt := time.Now().Add(ttl)
+
+	var recordID primitive.ObjectID
+	if !options.Ephemeral {
+		record := &models.Command{
+			DeviceID:  a.id,
+			Command:   command,
+			Priority:  int(options.Priority),
+			Origin:    options.Origin,
+			Status:    models.CommandPending,
+			ExpiresAt: expiresAt,
+		}
+		if err := a.commandService.CreateCommand(record); err != nil {
+			log.Printf("Failed to persist command '%s': %v", command, err)
+		} else {
+			recordID = record.ID
+		}
 	}
 
-	a.isReady = false
-	log.Printf("→ %s", command)
-	return nil
+	a.mutex.Lock()
+	if a.state != StateConnected && a.state != StateReconnecting {
+		a.mutex.Unlock()
+		a.commandMutex.Unlock()
+		if recordID.IsZero() {
+			return nil, fmt.Errorf("not connected to Arduino")
+		}
+		return &CommandResult{ID: recordID.Hex(), Command: command, Status: CommandQueued}, nil
+	}
+
+	a.nextCommandID++
+	cmd := newPendingCommand(a.nextCommandID, command, expiresAt)
+	cmd.recordID = recordID
+	cmd.priority = options.Priority
+	cmd.resend = options.resend
+	cmd.origin = options.Origin
+	superseded := a.enqueueCommand(cmd)
+	a.mutex.Unlock()
+	a.commandMutex.Unlock()
+
+	for _, obsolete := range superseded {
+		log.Printf("Command '%s' superseded by '%s'", obsolete.command, command)
+		a.finishCommand(obsolete, CommandSuperseded, "", 0)
+	}
+
+	return <-cmd.result, nil
+}
+
+// SetCommandTTL sets how long commands may wait in the queue by default
+func (a *ArduinoSerial) SetCommandTTL(ttl time.Duration) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.commandTTL = ttl
 }
 
 // GetCurrentData returns the latest sensor reading
@@ -190,80 +322,69 @@ func (a *ArduinoSerial) GetCurrentData() *models.SensorReading {
 	return a.currentData
 }
 
-// GetActuatorStates returns current actuator states
+// GetActuatorStates returns the actuator states last reported by the board
 func (a *ArduinoSerial) GetActuatorStates() *models.ActuatorStates {
 	a.mutex.RLock()
 	defer a.mutex.RUnlock()
 	return a.actuatorStates
 }
 
-// SetActuatorState manually sets actuator state for synchronization
-func (a *ArduinoSerial) SetActuatorState(actuator string, value interface{}) {
+// SetActuatorState records the desired state of an actuator. The reconciler
+// sends the matching command if the board does not report it.
+func (a *ArduinoSerial) SetActuatorState(name string, setting ActuatorSetting) error {
+	actuator, ok := GetActuator(name)
+	if !ok {
+		return fmt.Errorf("unknown actuator %q", name)
+	}
+	command, err := actuator.Command(setting)
+	if err != nil {
+		return err
+	}
+
+	field, value, _ := commandState(command)
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
-
-	switch actuator {
-	case "white_light":
-		if val, ok := value.(bool); ok {
-			a.actuatorStates.WhiteLight = val
-		}
-	case "yellow_light":
-		if val, ok := value.(bool); ok {
-			a.actuatorStates.YellowLight = val
-		}
-	case "relay":
-		if val, ok := value.(bool); ok {
-			a.actuatorStates.Relay = val
-		}
-	case "fan":
-		if val, ok := value.(bool); ok {
-			a.actuatorStates.Fan = val
-		}
-	case "buzzer":
-		if val, ok := value.(bool); ok {
-			a.actuatorStates.Buzzer = val
-		}
-	case "door_angle":
-		if val, ok := value.(float64); ok {
-			a.actuatorStates.DoorAngle = int(val)
-		}
-	case "window_angle":
-		if val, ok := value.(float64); ok {
-			a.actuatorStates.WindowAngle = int(val)
-		}
-	case "fan_speed":
-		if val, ok := value.(float64); ok {
-			a.actuatorStates.FanSpeed = int(val)
-		}
-	}
+	a.recordDesired(field, value, false)
+	return nil
 }
 
 // startDataListener listens for incoming data from Arduino
-func (a *ArduinoSerial) startDataListener() {
+func (a *ArduinoSerial) startDataListener(transport Transport, stop <-chan bool) {
 	defer a.wg.Done()
 
-	scanner := bufio.NewScanner(a.port)
+	scanner := bufio.NewScanner(transport)
 
 	for scanner.Scan() {
 		select {
-		case <-a.stopChan:
+		case <-stop:
 			return
 		default:
 			line := strings.TrimSpace(scanner.Text())
 			if line != "" {
 				log.Printf("← %s", line)
-				a.handleIncomingData(line)
+				if payload, ok := a.decodeLine(line); ok {
+					a.handleIncomingData(payload)
+				}
 			}
 		}
 	}
 
+	select {
+	case <-stop:
+		return
+	default:
+	}
+
+	reason := "link closed"
 	if err := scanner.Err(); err != nil {
 		log.Printf("Serial scanner error: %v", err)
+		reason = fmt.Sprintf("read error: %v", err)
 	}
+	a.reportLinkLost(reason)
 }
 
 // startDataSaver periodically saves buffered data
-func (a *ArduinoSerial) startDataSaver() {
+func (a *ArduinoSerial) startDataSaver(stop <-chan bool) {
 	defer a.wg.Done()
 
 	ticker := time.NewTicker(a.saveInterval)
@@ -271,43 +392,46 @@ func (a *ArduinoSerial) startDataSaver() {
 
 	for {
 		select {
-		case <-a.stopChan:
+		case <-stop:
 			return
 		case <-ticker.C:
 			a.saveBufferedData()
+			a.saveActuatorEvents()
 		}
 	}
 }
 
 // handleIncomingData processes incoming serial data
 func (a *ArduinoSerial) handleIncomingData(line string) {
-	// Handle ACK
-	if line == "ACK" {
+	// The board prints READY after every reset and starts over on v1 with
+	// every output at its default
+	if line == "READY" {
 		a.mutex.Lock()
-		a.isReady = true
-
-		// Send next queued command
-		if len(a.commandQueue) > 0 {
-			nextCommand := a.commandQueue[0]
-			a.commandQueue = a.commandQueue[1:]
-			a.mutex.Unlock()
-
-			// Send with slight delay
-			time.AfterFunc(100*time.Millisecond, func() {
-				a.SendCommand(nextCommand)
-			})
-		} else {
-			a.mutex.Unlock()
-		}
+		a.resetProtocol()
+		a.mutex.Unlock()
+		go a.negotiateProtocol()
+		go a.restoreActuators()
+		return
+	}
+
+	// Newer boards speak JSON lines alongside the legacy format
+	if isJSONLine(line) {
+		a.handleJSONLine(line)
+		return
+	}
+
+	// Acknowledgements and errors answer the command in flight
+	if isReply(line) {
+		a.applyProtocolAck(line)
+		reply := deviceReply{line: line}
+		a.parseActuatorResponse(reply)
+		a.deliverReply(reply)
 		return
 	}
 
 	// Parse sensor data
 	if strings.Contains(line, "GAS:") {
 		a.parseSensorData(line)
-	} else {
-		// Parse actuator responses
-		a.parseActuatorResponse(line)
 	}
 }
 
@@ -318,6 +442,7 @@ func (a *ArduinoSerial) parseSensorData(line string) {
 		Timestamp: time.Now(),
 	}
 
+	fields := 0
 	parts := strings.Split(line, ",")
 	for _, part := range parts {
 		keyValue := strings.Split(part, ":")
@@ -329,48 +454,90 @@ func (a *ArduinoSerial) parseSensorData(line string) {
 		valueStr := strings.TrimSpace(keyValue[1])
 		value, err := strconv.Atoi(valueStr)
 		if err != nil {
+			// Sensors unknown to the server may report fractional values
+			if channel, err := strconv.ParseFloat(valueStr, 64); err == nil && !isKnownSensor(key) {
+				data.SetChannel(key, channel)
+			}
 			continue
 		}
 
 		switch key {
 		case "gas":
 			data.Gas = value
+			fields++
 		case "light":
 			data.Light = value
+			fields++
 		case "soil":
 			data.Soil = value
+			fields++
 		case "water":
 			data.Water = value
+			fields++
 		case "infrar":
 			data.Infrar = value
 		case "btn1":
 			data.Btn1 = value
 		case "btn2":
 			data.Btn2 = value
+		default:
+			data.SetChannel(key, float64(value))
 		}
 	}
 
+	// Reject lines missing any of the main sensor readings, which happens
+	// when unframed v1 lines are corrupted in transit
+	if fields < 4 {
+		a.mutex.Lock()
+		a.protocolStats.RejectedLines++
+		a.mutex.Unlock()
+		log.Printf("Rejected incomplete sensor line %q", line)
+		return
+	}
+
 	// Validate that we have the main sensor readings
 	if data.Gas == 0 && data.Light == 0 && data.Soil == 0 && data.Water == 0 {
 		return
 	}
 
+	a.processReading(data)
+}
+
+// processReading publishes a parsed reading, evaluates rules against it and
+// buffers it for storage
+func (a *ArduinoSerial) processReading(data *models.SensorReading) {
 	a.mutex.Lock()
+	for key, value := range a.pendingChannels {
+		if _, ok := data.Channels[key]; !ok {
+			data.SetChannel(key, value)
+		}
+	}
+	a.pendingChannels = nil
 	a.currentData = data
+	a.lastTelemetry = data.Timestamp
+	a.signals.Add(data)
+	toggleMode := a.modeButtons.update(data)
 
-	var actionsToExecute []string
+	var actionsToExecute []models.TriggeredAction
 
 	// Add to buffer for saving
 	sensorData := models.SensorData{
+		DeviceID:  a.id,
 		Light:     data.Light,
 		Gas:       data.Gas,
 		Soil:      data.Soil,
 		Water:     data.Water,
 		Infrared:  data.Infrar,
+		Channels:  data.Channels,
 		Timestamp: data.Timestamp,
 	}
 	// Evaluate rules and get alerts and triggered actions
-	alerts, triggeredActions := a.ruleService.EvaluateRules(data)
+	alerts, triggeredActions := a.ruleService.EvaluateRules(a.id, services.RuleInput{
+		Reading:   data,
+		Actuators: a.actuatorStates,
+		Signals:   a.signals,
+		Mode:      a.modeService.GetMode(),
+	})
 	if len(alerts) > 0 {
 		sensorData.Alerts = alerts
 	}
@@ -388,72 +555,55 @@ func (a *ArduinoSerial) parseSensorData(line string) {
 
 	a.mutex.Unlock()
 
+	if toggleMode {
+		go a.toggleMode()
+	}
+
 	if len(actionsToExecute) > 0 {
 		copyOfActions := actionsToExecute
-		go func(actions []string) {
+		go func(actions []models.TriggeredAction) {
 			// Execute outside the data lock to keep sensor polling responsive.
 			a.executeTriggeredActions(actions)
 		}(copyOfActions)
 	}
 }
 
-// parseActuatorResponse parses actuator state changes from Arduino
-func (a *ArduinoSerial) parseActuatorResponse(line string) {
+// parseActuatorResponse records the actuator state confirmed by an
+// acknowledgement from Arduino. Changes are attributed to the origin of the
+// command in flight, or to the device when the reply answers none.
+func (a *ArduinoSerial) parseActuatorResponse(reply deviceReply) {
+	command, ok := replyCommand(reply.line)
+	if !ok {
+		return
+	}
+
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
 
-	line = strings.ToLower(line)
-
-	// Parse various actuator responses
-	if strings.Contains(line, "light on") {
-		if strings.Contains(line, "white") {
-			a.actuatorStates.WhiteLight = true
-		} else if strings.Contains(line, "yellow") {
-			a.actuatorStates.YellowLight = true
-		}
-	} else if strings.Contains(line, "light off") {
-		if strings.Contains(line, "white") {
-			a.actuatorStates.WhiteLight = false
-		} else if strings.Contains(line, "yellow") {
-			a.actuatorStates.YellowLight = false
-		}
-	} else if strings.Contains(line, "fan on") {
-		a.actuatorStates.Fan = true
-	} else if strings.Contains(line, "fan off") {
-		a.actuatorStates.Fan = false
-	} else if strings.Contains(line, "relay on") {
-		a.actuatorStates.Relay = true
-	} else if strings.Contains(line, "relay off") {
-		a.actuatorStates.Relay = false
-	} else if strings.Contains(line, "buzzer on") {
-		a.actuatorStates.Buzzer = true
-	} else if strings.Contains(line, "buzzer off") {
-		a.actuatorStates.Buzzer = false
-	}
-
-	// Parse servo positions
-	if matches := regexp.MustCompile(`door.*?(\d+)`).FindStringSubmatch(line); len(matches) > 1 {
-		if angle, err := strconv.Atoi(matches[1]); err == nil {
-			a.actuatorStates.DoorAngle = angle
-		}
+	origin := models.Origin{Kind: models.OriginDevice}
+	if a.inFlight != nil && reply.answers(a.inFlight) {
+		origin = a.inFlight.origin
 	}
-	if matches := regexp.MustCompile(`window.*?(\d+)`).FindStringSubmatch(line); len(matches) > 1 {
-		if angle, err := strconv.Atoi(matches[1]); err == nil {
-			a.actuatorStates.WindowAngle = angle
-		}
+	if field, value, ok := commandState(command); ok {
+		a.recordReported(field, value, command, origin)
+	}
+
+	// Songs end on their own, so this only tracks whether one may be playing
+	if musicCommands[command] {
+		a.musicPlaying = true
+	} else if command == "stop_music" {
+		a.musicPlaying = false
 	}
 }
 
 // executeTriggeredActions executes actions based on triggered rules
-func (a *ArduinoSerial) executeTriggeredActions(actions []string) {
-	log.Printf("Executing %d triggered actions: %v", len(actions), actions)
+func (a *ArduinoSerial) executeTriggeredActions(actions []models.TriggeredAction) {
+	log.Printf("Executing actions of %d triggered rule(s)", len(actions))
 
-	for _, action := range actions {
-		log.Printf("Executing action '%s'", action)
-		err := a.SendCommand(action)
-		if err != nil {
-			log.Printf("Error executing action '%s': %v", action, err)
-		}
+	// Each rule runs its sequence on its own, so delays in one rule do not
+	// hold up another
+	for _, triggered := range actions {
+		go a.runRuleActions(triggered)
 	}
 }
 
@@ -481,3 +631,28 @@ func (a *ArduinoSerial) saveBufferedData() {
 		a.mutex.Unlock()
 	}
 }
+
+// saveActuatorEvents saves buffered actuator events to database
+func (a *ArduinoSerial) saveActuatorEvents() {
+	a.mutex.Lock()
+	if len(a.actuatorEvents) == 0 {
+		a.mutex.Unlock()
+		return
+	}
+
+	events := a.actuatorEvents
+	a.actuatorEvents = nil
+	a.mutex.Unlock()
+
+	if err := a.actuatorService.SaveEvents(events); err != nil {
+		log.Printf("Error saving actuator events: %v", err)
+
+		// Put events back in buffer if save failed
+		a.mutex.Lock()
+		a.actuatorEvents = append(events, a.actuatorEvents...)
+		if len(a.actuatorEvents) > 100 {
+			a.actuatorEvents = a.actuatorEvents[len(a.actuatorEvents)-50:]
+		}
+		a.mutex.Unlock()
+	}
+}
@@ -0,0 +1,477 @@
+package serial
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+	"github.com/qiniu/qmgo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Command result statuses
+const (
+	CommandSucceeded  = "success"
+	CommandFailed     = "device_error"
+	CommandTimedOut   = "timeout"
+	CommandCanceled   = "canceled"
+	CommandExpired    = "expired"
+	CommandQueued     = "queued"
+	CommandSuperseded = "superseded"
+)
+
+// recordStatuses maps final command results to the status stored for them
+var recordStatuses = map[string]string{
+	CommandSucceeded:  models.CommandAcked,
+	CommandFailed:     models.CommandFailed,
+	CommandTimedOut:   models.CommandFailed,
+	CommandCanceled:   models.CommandCanceled,
+	CommandExpired:    models.CommandExpired,
+	CommandSuperseded: models.CommandSuperseded,
+}
+
+// CommandOptions control how a command is queued
+type CommandOptions struct {
+	TTL       time.Duration   // how long the command may wait, the device default when zero
+	Ephemeral bool            // ephemeral commands are not persisted and do not survive a disconnect
+	Priority  CommandPriority // queue lane, PriorityNormal when zero
+	Origin    models.Origin   // who or what issued the command
+	resend    bool            // sent by the reconciler
+}
+
+// commandStore persists the command queue of a device. It is implemented by
+// services.CommandService.
+type commandStore interface {
+	CreateCommand(command *models.Command) error
+	MarkCommandSent(id primitive.ObjectID) error
+	UpdateCommandStatus(id primitive.ObjectID, status, reply string, attempts int) error
+	RestoreCommands(deviceID string) ([]models.Command, error)
+}
+
+// CommandResult is the outcome of a command sent to the board
+type CommandResult struct {
+	ID         string `json:"id,omitempty"`
+	Command    string `json:"command"`
+	Status     string `json:"status"`
+	Reply      string `json:"reply,omitempty"`
+	Attempts   int    `json:"attempts"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// OK reports whether the board acknowledged the command
+func (r *CommandResult) OK() bool {
+	return r.Status == CommandSucceeded
+}
+
+// pendingCommand is a command waiting in the queue or in flight
+type pendingCommand struct {
+	id        int
+	recordID  primitive.ObjectID // zero for ephemeral commands
+	command   string
+	priority  CommandPriority
+	resend    bool
+	origin    models.Origin
+	queuedAt  time.Time
+	expiresAt time.Time
+	result    chan *CommandResult
+}
+
+// newPendingCommand creates a queued command
+func newPendingCommand(id int, command string, expiresAt time.Time) *pendingCommand {
+	return &pendingCommand{
+		id:        id,
+		command:   command,
+		queuedAt:  time.Now(),
+		expiresAt: expiresAt,
+		result:    make(chan *CommandResult, 1),
+	}
+}
+
+// persisted reports whether the command is stored in the database
+func (p *pendingCommand) persisted() bool {
+	return !p.recordID.IsZero()
+}
+
+// recordHex returns the ID of the stored command, empty for ephemeral commands
+func (p *pendingCommand) recordHex() string {
+	if !p.persisted() {
+		return ""
+	}
+	return p.recordID.Hex()
+}
+
+// resolve delivers the final result to the waiting sender
+func (p *pendingCommand) resolve(status, reply string, attempts int) *CommandResult {
+	result := &CommandResult{
+		ID:         p.recordHex(),
+		Command:    p.command,
+		Status:     status,
+		Reply:      reply,
+		Attempts:   attempts,
+		DurationMs: time.Since(p.queuedAt).Milliseconds(),
+	}
+	p.result <- result
+	return result
+}
+
+// ackTexts maps each firmware command to the acknowledgement it prints
+var ackTexts = map[string]string{
+	"white_light_on":   "ACK: White light ON",
+	"white_light_off":  "ACK: White light OFF",
+	"yellow_light_on":  "ACK: Yellow light ON",
+	"yellow_light_off": "ACK: Yellow light OFF",
+	"relay_on":         "ACK: Relay ON",
+	"relay_off":        "ACK: Relay OFF",
+	"door_open":        "ACK: Door opened",
+	"door_close":       "ACK: Door closed",
+	"window_open":      "ACK: Window opened",
+	"window_close":     "ACK: Window closed",
+	"fan_on":           "ACK: Fan ON",
+	"fan_off":          "ACK: Fan OFF",
+	"buzzer_on":        "ACK: Buzzer ON",
+	"buzzer_off":       "ACK: Buzzer OFF",
+	"play_birthday":    "ACK: Starting birthday song",
+	"play_ode_to_joy":  "ACK: Starting Ode to Joy",
+	"stop_music":       "ACK: Music stopped",
+}
+
+// ackPrefixes maps parameterised commands to the prefix of their acknowledgement
+var ackPrefixes = map[string]string{
+	"door_angle=":   "ACK: Door angle: ",
+	"window_angle=": "ACK: Window angle: ",
+	"fan_speed=":    "ACK: Fan speed: ",
+	"proto=":        protocolAckPrefix,
+}
+
+// replyCommand returns the command an acknowledgement answers
+func replyCommand(line string) (string, bool) {
+	for command, text := range ackTexts {
+		if line == text {
+			return command, true
+		}
+	}
+	for prefix, ackPrefix := range ackPrefixes {
+		if strings.HasPrefix(line, ackPrefix) {
+			return prefix + strings.TrimPrefix(line, ackPrefix), true
+		}
+	}
+	return "", false
+}
+
+// deviceReply is an acknowledgement or error received from the board
+type deviceReply struct {
+	line string // "ACK: ..." or "ERROR: ..."
+	id   int    // command ID echoed by JSON-lines boards, 0 when absent
+}
+
+// isError reports whether the board rejected the command
+func (r deviceReply) isError() bool {
+	return strings.HasPrefix(r.line, "ERROR")
+}
+
+// answers reports whether the reply belongs to the given command. Replies
+// carrying an ID are matched on it, others on the acknowledgement text.
+func (r deviceReply) answers(cmd *pendingCommand) bool {
+	if r.id != 0 {
+		return r.id == cmd.id
+	}
+	return matchReply(cmd.command, r.line)
+}
+
+// isReply reports whether a line is a command acknowledgement or error
+func isReply(line string) bool {
+	return strings.HasPrefix(line, "ACK") || strings.HasPrefix(line, "ERROR")
+}
+
+// matchReply reports whether a reply line answers the given command.
+// Commands the firmware does not know are answered with "ERROR: <command>".
+func matchReply(command, reply string) bool {
+	if strings.HasPrefix(reply, "ERROR") {
+		return strings.TrimSpace(strings.TrimPrefix(reply, "ERROR:")) == command
+	}
+
+	if expected, ok := ackTexts[command]; ok {
+		return reply == expected
+	}
+	for prefix, ackPrefix := range ackPrefixes {
+		if strings.HasPrefix(command, prefix) {
+			return reply == ackPrefix+strings.TrimSpace(command[len(prefix):])
+		}
+	}
+
+	// Unknown commands accept any acknowledgement
+	return strings.HasPrefix(reply, "ACK")
+}
+
+// enqueueCommand queues a command by priority and wakes the dispatcher. Must
+// be called with the lock held. It returns the queued commands the new one
+// supersedes, which the caller finishes once the lock is released.
+func (a *ArduinoSerial) enqueueCommand(cmd *pendingCommand) []*pendingCommand {
+	superseded := a.coalesceCommands(cmd)
+	a.insertCommand(cmd, false)
+
+	// Music plays on the buzzer pin, so it is stopped before safety commands
+	if cmd.priority == PrioritySafety && a.musicPlaying {
+		a.nextCommandID++
+		stop := newPendingCommand(a.nextCommandID, "stop_music", cmd.expiresAt)
+		stop.priority = PrioritySafety
+		stop.origin = cmd.origin
+		a.insertCommand(stop, true)
+		a.musicPlaying = false
+	}
+
+	select {
+	case a.queueSignal <- struct{}{}:
+	default:
+	}
+	return superseded
+}
+
+// dequeueCommand pops the next command from the queue
+func (a *ArduinoSerial) dequeueCommand() *pendingCommand {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if len(a.commandQueue) == 0 {
+		return nil
+	}
+	cmd := a.commandQueue[0]
+	a.commandQueue = a.commandQueue[1:]
+	return cmd
+}
+
+// requeueCommand puts an interrupted command back at the head of its
+// priority class so it is sent again once the link is restored
+func (a *ArduinoSerial) requeueCommand(cmd *pendingCommand) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.state == StateDisconnected {
+		releaseCommand(cmd)
+		return
+	}
+	a.insertCommand(cmd, true)
+}
+
+// releaseQueuedCommands empties the queue on disconnect. Persisted commands
+// stay pending in the database and are restored on the next connect.
+func (a *ArduinoSerial) releaseQueuedCommands() {
+	a.mutex.Lock()
+	queued := a.commandQueue
+	a.commandQueue = nil
+	a.mutex.Unlock()
+
+	for _, cmd := range queued {
+		releaseCommand(cmd)
+	}
+}
+
+// releaseCommand answers the sender of a command that leaves the queue
+// without being sent
+func releaseCommand(cmd *pendingCommand) {
+	if cmd.persisted() {
+		cmd.resolve(CommandQueued, "", 0)
+		return
+	}
+	cmd.resolve(CommandCanceled, "", 0)
+}
+
+// restoreQueuedCommands queues the stored commands left unfinished by an
+// earlier session or process. Must be called with the lock held.
+func (a *ArduinoSerial) restoreQueuedCommands(records []models.Command) {
+	for _, record := range records {
+		a.nextCommandID++
+		cmd := newPendingCommand(a.nextCommandID, record.Command, record.ExpiresAt)
+		cmd.recordID = record.ID
+		cmd.priority = CommandPriority(record.Priority)
+		cmd.origin = record.Origin
+		cmd.queuedAt = record.CreatedAt
+		a.insertCommand(cmd, false)
+	}
+	if len(records) > 0 {
+		log.Printf("Restored %d queued command(s) for %s", len(records), a.id)
+	}
+}
+
+// CancelCommand removes a queued command, answering its sender with
+// CommandCanceled. It reports whether the command was in the queue.
+func (a *ArduinoSerial) CancelCommand(id primitive.ObjectID) bool {
+	a.mutex.Lock()
+	var canceled *pendingCommand
+	for i, cmd := range a.commandQueue {
+		if cmd.recordID == id {
+			canceled = cmd
+			a.commandQueue = append(a.commandQueue[:i:i], a.commandQueue[i+1:]...)
+			break
+		}
+	}
+	a.mutex.Unlock()
+
+	if canceled == nil {
+		return false
+	}
+	canceled.resolve(CommandCanceled, "", 0)
+	return true
+}
+
+// finishCommand delivers the final result of a command and records it
+func (a *ArduinoSerial) finishCommand(cmd *pendingCommand, status, reply string, attempts int) *CommandResult {
+	result := cmd.resolve(status, reply, attempts)
+	if cmd.persisted() {
+		if err := a.commandService.UpdateCommandStatus(cmd.recordID, recordStatuses[status], reply, attempts); err != nil {
+			log.Printf("Failed to record result of command '%s': %v", cmd.command, err)
+		}
+	}
+	return result
+}
+
+// markCommandSent records that a command is about to be written. It reports
+// false when the command was canceled in the meantime.
+func (a *ArduinoSerial) markCommandSent(cmd *pendingCommand) bool {
+	if !cmd.persisted() {
+		return true
+	}
+
+	err := a.commandService.MarkCommandSent(cmd.recordID)
+	if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return false
+	}
+	if err != nil {
+		log.Printf("Failed to record command '%s' as sent: %v", cmd.command, err)
+	}
+	return true
+}
+
+// startCommandDispatcher sends queued commands one at a time, waiting for
+// each to be acknowledged before sending the next
+func (a *ArduinoSerial) startCommandDispatcher(transport Transport, stop <-chan bool) {
+	defer a.wg.Done()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-a.queueSignal:
+		}
+
+		for {
+			cmd := a.dequeueCommand()
+			if cmd == nil {
+				break
+			}
+			if time.Now().After(cmd.expiresAt) {
+				log.Printf("Command '%s' expired before it could be sent", cmd.command)
+				a.finishCommand(cmd, CommandExpired, "", 0)
+				continue
+			}
+			if !a.markCommandSent(cmd) {
+				cmd.resolve(CommandCanceled, "", 0)
+				continue
+			}
+
+			a.mutex.Lock()
+			a.inFlight = cmd
+			if field, value, ok := commandState(cmd.command); ok {
+				a.recordDesired(field, value, cmd.resend)
+			}
+			a.mutex.Unlock()
+
+			result, stopped := a.dispatchCommand(transport, cmd, stop)
+
+			a.mutex.Lock()
+			a.inFlight = nil
+			a.mutex.Unlock()
+			if stopped {
+				return
+			}
+			if !result.OK() {
+				log.Printf("Command '%s' finished with %s after %d attempt(s)", result.Command, result.Status, result.Attempts)
+			}
+		}
+	}
+}
+
+// dispatchCommand writes a command and waits for its reply, retrying with
+// backoff on timeout. It reports whether the dispatcher was stopped, in which
+// case the command goes back to the head of the queue.
+func (a *ArduinoSerial) dispatchCommand(transport Transport, cmd *pendingCommand, stop <-chan bool) (*CommandResult, bool) {
+	backoff := a.retryBackoff
+
+	for attempt := 1; attempt <= a.maxRetries+1; attempt++ {
+		a.drainReplies()
+
+		if _, err := transport.Write([]byte(a.encodeCommand(cmd) + "\n")); err != nil {
+			log.Printf("Failed to send command '%s': %v", cmd.command, err)
+			return a.finishCommand(cmd, CommandFailed, err.Error(), attempt), false
+		}
+		log.Printf("→ %s", cmd.command)
+
+		reply, status := a.awaitReply(cmd, stop)
+		switch status {
+		case CommandSucceeded, CommandFailed:
+			return a.finishCommand(cmd, status, reply, attempt), false
+		case CommandCanceled:
+			a.requeueCommand(cmd)
+			return nil, true
+		}
+
+		if attempt <= a.maxRetries {
+			log.Printf("No reply to '%s', retrying in %v", cmd.command, backoff)
+			select {
+			case <-stop:
+				a.requeueCommand(cmd)
+				return nil, true
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+	}
+
+	return a.finishCommand(cmd, CommandTimedOut, "", a.maxRetries+1), false
+}
+
+// awaitReply waits for the reply matching a command
+func (a *ArduinoSerial) awaitReply(cmd *pendingCommand, stop <-chan bool) (string, string) {
+	timer := time.NewTimer(a.ackTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return "", CommandCanceled
+		case <-timer.C:
+			return "", CommandTimedOut
+		case reply := <-a.replies:
+			if !reply.answers(cmd) {
+				log.Printf("Ignoring unexpected reply '%s' while waiting for '%s'", reply.line, cmd.command)
+				continue
+			}
+			if reply.isError() {
+				return reply.line, CommandFailed
+			}
+			return reply.line, CommandSucceeded
+		}
+	}
+}
+
+// drainReplies discards stale replies left over from earlier attempts
+func (a *ArduinoSerial) drainReplies() {
+	for {
+		select {
+		case <-a.replies:
+		default:
+			return
+		}
+	}
+}
+
+// deliverReply hands a reply line from the board to the dispatcher
+func (a *ArduinoSerial) deliverReply(reply deviceReply) {
+	select {
+	case a.replies <- reply:
+	default:
+		log.Printf("Dropping reply '%s': no command waiting", reply.line)
+	}
+}
@@ -0,0 +1,103 @@
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+	"github.com/qiniu/qmgo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeCommands is a command store whose MarkCommandSent fails with markErr
+type fakeCommands struct {
+	markErr error
+}
+
+func (f *fakeCommands) CreateCommand(command *models.Command) error {
+	command.ID = primitive.NewObjectID()
+	return nil
+}
+
+func (f *fakeCommands) MarkCommandSent(id primitive.ObjectID) error {
+	return f.markErr
+}
+
+func (f *fakeCommands) UpdateCommandStatus(id primitive.ObjectID, status, reply string, attempts int) error {
+	return nil
+}
+
+func (f *fakeCommands) RestoreCommands(deviceID string) ([]models.Command, error) {
+	return nil, nil
+}
+
+// recordingTransport records the lines written to it and never replies
+type recordingTransport struct {
+	mutex   sync.Mutex
+	written []string
+}
+
+func (t *recordingTransport) Read(p []byte) (int, error) { select {} }
+func (t *recordingTransport) Open() error                { return nil }
+func (t *recordingTransport) Close() error               { return nil }
+func (t *recordingTransport) Info() TransportInfo        { return TransportInfo{Kind: "test"} }
+
+func (t *recordingTransport) Write(p []byte) (int, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.written = append(t.written, string(p))
+	return len(p), nil
+}
+
+func TestDispatcherSkipsCanceledCommands(t *testing.T) {
+	tests := []struct {
+		name        string
+		markErr     error
+		wantStatus  string
+		wantWritten bool
+	}{
+		{"pending", nil, CommandTimedOut, true},
+		{"canceled", qmgo.ErrNoSuchDocuments, CommandCanceled, false},
+		{"canceled, wrapped", fmt.Errorf("failed to mark command sent: %w", qmgo.ErrNoSuchDocuments), CommandCanceled, false},
+		{"store unavailable", errors.New("connection reset"), CommandTimedOut, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewArduinoSerial("test", nil, nil, nil, nil, nil, nil, nil)
+			a.commandService = &fakeCommands{markErr: tt.markErr}
+			a.ackTimeout = 10 * time.Millisecond
+			a.maxRetries = 0
+
+			cmd := newPendingCommand(1, "fan_on", time.Now().Add(time.Minute))
+			cmd.recordID = primitive.NewObjectID()
+			a.mutex.Lock()
+			a.enqueueCommand(cmd)
+			a.mutex.Unlock()
+
+			transport := &recordingTransport{}
+			stop := make(chan bool)
+			a.wg.Add(1)
+			go a.startCommandDispatcher(transport, stop)
+
+			var result *CommandResult
+			select {
+			case result = <-cmd.result:
+			case <-time.After(2 * time.Second):
+				t.Fatal("command was never resolved")
+			}
+			close(stop)
+			a.wg.Wait()
+
+			if result.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", result.Status, tt.wantStatus)
+			}
+			if written := len(transport.written) > 0; written != tt.wantWritten {
+				t.Errorf("written %q, want written %v", transport.written, tt.wantWritten)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package serial
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+// Locations used for port discovery on Linux
+const (
+	sysClassTTY = "/sys/class/tty"
+	devSerialID = "/dev/serial/by-id"
+)
+
+// devicePatterns are the device nodes created for USB serial adapters
+var devicePatterns = []string{"/dev/ttyUSB*", "/dev/ttyACM*"}
+
+// arduinoVendors lists USB vendor IDs used by Arduino boards
+var arduinoVendors = map[string]bool{
+	"2341": true, // Arduino SA
+	"2a03": true, // Arduino.org
+}
+
+// arduinoCloneDevices lists vendor:product pairs of USB bridges common on
+// Arduino-compatible boards
+var arduinoCloneDevices = map[string]bool{
+	"1a86:7523": true, // WCH CH340
+	"0403:6001": true, // FTDI FT232R
+}
+
+// PortInfo describes a serial port found on the system
+type PortInfo struct {
+	Name         string `json:"name"`
+	ByID         string `json:"byId,omitempty"`
+	VendorID     string `json:"vendorId,omitempty"`
+	ProductID    string `json:"productId,omitempty"`
+	SerialNumber string `json:"serialNumber,omitempty"`
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Product      string `json:"product,omitempty"`
+	IsArduino    bool   `json:"isArduino"`
+}
+
+// StablePath returns the by-id path when available, which survives
+// re-enumeration, and the device node otherwise
+func (p PortInfo) StablePath() string {
+	if p.ByID != "" {
+		return p.ByID
+	}
+	return p.Name
+}
+
+// ListPorts returns the serial ports present on the system
+func ListPorts() ([]PortInfo, error) {
+	if runtime.GOOS == "linux" {
+		return listLinuxPorts()
+	}
+	return probePorts(), nil
+}
+
+// FindPort returns the first port whose device node, by-id path or serial
+// number matches, or whose by-id name contains the match string. An empty
+// match selects the first port that looks like an Arduino.
+func FindPort(match string) (*PortInfo, error) {
+	ports, err := ListPorts()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, port := range ports {
+		if match == "" {
+			if port.IsArduino {
+				return &port, nil
+			}
+			continue
+		}
+		if port.Name == match || port.ByID == match || (port.SerialNumber != "" && port.SerialNumber == match) {
+			return &port, nil
+		}
+		if port.ByID != "" && strings.Contains(filepath.Base(port.ByID), match) {
+			return &port, nil
+		}
+	}
+
+	if match == "" {
+		return nil, fmt.Errorf("no Arduino found among %d serial port(s)", len(ports))
+	}
+	return nil, fmt.Errorf("no serial port matches %q", match)
+}
+
+// ResolveAddress turns a configured serial port into a device path. An empty
+// address or "auto" picks the first Arduino; an address that is not an
+// existing device node is matched against by-id names and serial numbers.
+// Addresses of other transport kinds are returned unchanged.
+func ResolveAddress(kind, address string) (string, error) {
+	if kind != "" && kind != TransportSerial {
+		return address, nil
+	}
+
+	if address == "auto" {
+		address = ""
+	}
+	if address != "" {
+		// Existing paths and, outside Linux, COM names are used as-is
+		if _, err := os.Stat(address); err == nil || runtime.GOOS != "linux" {
+			return address, nil
+		}
+	}
+
+	port, err := FindPort(address)
+	if err != nil {
+		return "", err
+	}
+	return port.StablePath(), nil
+}
+
+// listLinuxPorts enumerates USB serial devices and reads their metadata from sysfs
+func listLinuxPorts() ([]PortInfo, error) {
+	var names []string
+	for _, pattern := range devicePatterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", pattern, err)
+		}
+		names = append(names, matches...)
+	}
+	sort.Strings(names)
+
+	byID := stableLinks()
+
+	ports := make([]PortInfo, 0, len(names))
+	for _, name := range names {
+		port := PortInfo{
+			Name: name,
+			ByID: byID[name],
+		}
+		readUSBAttributes(&port)
+		port.IsArduino = looksLikeArduino(port)
+		ports = append(ports, port)
+	}
+
+	return ports, nil
+}
+
+// stableLinks maps device nodes to their /dev/serial/by-id symlinks
+func stableLinks() map[string]string {
+	links := make(map[string]string)
+
+	entries, err := os.ReadDir(devSerialID)
+	if err != nil {
+		return links
+	}
+
+	for _, entry := range entries {
+		link := filepath.Join(devSerialID, entry.Name())
+		target, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			continue
+		}
+		links[target] = link
+	}
+	return links
+}
+
+// readUSBAttributes fills in USB descriptors by walking up from the tty's
+// sysfs device to the USB device that owns it
+func readUSBAttributes(port *PortInfo) {
+	device, err := filepath.EvalSymlinks(filepath.Join(sysClassTTY, filepath.Base(port.Name), "device"))
+	if err != nil {
+		return
+	}
+
+	for dir := device; dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, "idVendor")); err != nil {
+			continue
+		}
+		port.VendorID = readSysfsAttribute(dir, "idVendor")
+		port.ProductID = readSysfsAttribute(dir, "idProduct")
+		port.SerialNumber = readSysfsAttribute(dir, "serial")
+		port.Manufacturer = readSysfsAttribute(dir, "manufacturer")
+		port.Product = readSysfsAttribute(dir, "product")
+		return
+	}
+}
+
+// readSysfsAttribute reads a single-line sysfs attribute
+func readSysfsAttribute(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// looksLikeArduino guesses whether a port belongs to an Arduino board
+func looksLikeArduino(port PortInfo) bool {
+	vendor := strings.ToLower(port.VendorID)
+	product := strings.ToLower(port.ProductID)
+
+	if arduinoVendors[vendor] || arduinoCloneDevices[vendor+":"+product] {
+		return true
+	}
+	return strings.Contains(strings.ToLower(port.Manufacturer+" "+port.Product), "arduino")
+}
+
+// probePorts tries to open common COM port names on systems without sysfs
+func probePorts() []PortInfo {
+	ports := make([]PortInfo, 0)
+	for i := 1; i <= 10; i++ {
+		portName := fmt.Sprintf("COM%d", i)
+		config := &serial.Config{
+			Name:        portName,
+			Baud:        9600,
+			ReadTimeout: time.Millisecond * 100,
+		}
+
+		if port, err := serial.OpenPort(config); err == nil {
+			port.Close()
+			ports = append(ports, PortInfo{Name: portName})
+		}
+	}
+	return ports
+}
@@ -0,0 +1,229 @@
+package serial
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+)
+
+// JSON-lines message types. Boards send telemetry and command replies:
+//
+//	{"t":"telemetry","gas":123,"light":456,"soil":30,"water":100,"temp":21.5}
+//	{"t":"ack","id":7,"msg":"Fan ON"}
+//	{"t":"error","id":7,"msg":"fan_speed=300"}
+//
+// Telemetry is a reading only when it reports gas, light, soil and water.
+// Messages with other values alone update the live reading, and their
+// channels are stored with the next full reading.
+//
+// Once a board has sent a JSON line, commands are sent to it as
+//
+//	{"t":"cmd","id":7,"cmd":"fan_on"}
+const (
+	jsonTelemetry = "telemetry"
+	jsonAck       = "ack"
+	jsonError     = "error"
+	jsonCommand   = "cmd"
+)
+
+// knownSensors are the keys with dedicated SensorReading fields. Any other
+// numeric key is kept as a dynamic channel.
+var knownSensors = map[string]bool{
+	"gas":    true,
+	"light":  true,
+	"soil":   true,
+	"water":  true,
+	"infrar": true,
+	"btn1":   true,
+	"btn2":   true,
+}
+
+// mainSensors are the sensors a telemetry message must report to count as
+// a reading
+var mainSensors = []string{"gas", "light", "soil", "water"}
+
+// jsonCommandMessage is an outgoing command in JSON-lines form
+type jsonCommandMessage struct {
+	Type    string `json:"t"`
+	ID      int    `json:"id"`
+	Command string `json:"cmd"`
+}
+
+// isKnownSensor reports whether a key maps to a dedicated reading field
+func isKnownSensor(key string) bool {
+	return knownSensors[key]
+}
+
+// isJSONLine reports whether a line is a JSON object
+func isJSONLine(line string) bool {
+	return strings.HasPrefix(line, "{")
+}
+
+// encodeJSONCommand renders a command as a JSON line
+func encodeJSONCommand(cmd *pendingCommand) string {
+	data, err := json.Marshal(jsonCommandMessage{Type: jsonCommand, ID: cmd.id, Command: cmd.command})
+	if err != nil {
+		return cmd.command
+	}
+	return string(data)
+}
+
+// handleJSONLine processes a JSON telemetry or reply message
+func (a *ArduinoSerial) handleJSONLine(line string) {
+	var msg map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &msg); err != nil {
+		a.mutex.Lock()
+		a.protocolStats.RejectedLines++
+		a.mutex.Unlock()
+		log.Printf("Rejected malformed JSON line %q: %v", line, err)
+		return
+	}
+
+	a.mutex.Lock()
+	a.protocolStats.JSONMode = true
+	a.protocolStats.JSONLines++
+	a.mutex.Unlock()
+
+	msgType, _ := msg["t"].(string)
+	switch msgType {
+	case jsonTelemetry:
+		values := telemetryValues(msg)
+		switch {
+		case len(values) == 0:
+		case hasMainSensors(values):
+			a.processReading(telemetryReading(values))
+		default:
+			a.mergeTelemetry(values)
+		}
+	case jsonAck, jsonError:
+		reply := jsonReply(msgType, msg)
+		a.applyProtocolAck(reply.line)
+		a.parseActuatorResponse(reply)
+		a.deliverReply(reply)
+	default:
+		log.Printf("Ignoring JSON line with unknown type %q", msgType)
+	}
+}
+
+// telemetryValues returns the numeric values of a telemetry message by
+// lower-case key. Non-numeric values are ignored.
+func telemetryValues(msg map[string]interface{}) map[string]float64 {
+	values := make(map[string]float64, len(msg))
+	for key, raw := range msg {
+		key = strings.ToLower(key)
+		if key == "t" || key == "id" {
+			continue
+		}
+
+		switch v := raw.(type) {
+		case float64:
+			values[key] = v
+		case bool:
+			values[key] = 0
+			if v {
+				values[key] = 1
+			}
+		}
+	}
+	return values
+}
+
+// hasMainSensors reports whether telemetry values carry every main sensor,
+// like the legacy format requires of a reading
+func hasMainSensors(values map[string]float64) bool {
+	for _, key := range mainSensors {
+		if _, ok := values[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// telemetryReading converts telemetry values into a sensor reading
+func telemetryReading(values map[string]float64) *models.SensorReading {
+	data := &models.SensorReading{
+		Timestamp: time.Now(),
+	}
+	for key, value := range values {
+		setReadingValue(data, key, value)
+	}
+	return data
+}
+
+// setReadingValue sets a sensor field or channel of a reading
+func setReadingValue(data *models.SensorReading, key string, value float64) {
+	switch key {
+	case "gas":
+		data.Gas = int(value)
+	case "light":
+		data.Light = int(value)
+	case "soil":
+		data.Soil = int(value)
+	case "water":
+		data.Water = int(value)
+	case "infrar":
+		data.Infrar = int(value)
+	case "btn1":
+		data.Btn1 = int(value)
+	case "btn2":
+		data.Btn2 = int(value)
+	default:
+		data.SetChannel(key, value)
+	}
+}
+
+// mergeTelemetry applies a telemetry message that lacks main sensors without
+// treating it as a new reading, so no incomplete row is stored and no rules
+// run. Its values update the live reading, and its channels are stored with
+// the next full reading.
+func (a *ArduinoSerial) mergeTelemetry(values map[string]float64) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.lastTelemetry = time.Now()
+
+	if a.currentData != nil {
+		merged := *a.currentData
+		merged.Channels = nil
+		for key, value := range a.currentData.Channels {
+			merged.SetChannel(key, value)
+		}
+		for key, value := range values {
+			setReadingValue(&merged, key, value)
+		}
+		a.currentData = &merged
+	}
+
+	for key, value := range values {
+		if isKnownSensor(key) {
+			continue
+		}
+		if a.pendingChannels == nil {
+			a.pendingChannels = make(map[string]float64)
+		}
+		a.pendingChannels[key] = value
+	}
+}
+
+// jsonReply converts an ack or error message into the legacy reply form so
+// actuator state tracking and logging work unchanged
+func jsonReply(msgType string, msg map[string]interface{}) deviceReply {
+	prefix := "ACK"
+	if msgType == jsonError {
+		prefix = "ERROR"
+	}
+
+	line := prefix
+	if text, ok := msg["msg"].(string); ok && text != "" {
+		line = prefix + ": " + text
+	}
+
+	reply := deviceReply{line: line}
+	if id, ok := msg["id"].(float64); ok {
+		reply.id = int(id)
+	}
+	return reply
+}
@@ -0,0 +1,62 @@
+package serial
+
+import (
+	"log"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+)
+
+// modeButtonHold is how long BTN1 and BTN2 must be held together to toggle
+// the house mode
+const modeButtonHold = 3 * time.Second
+
+// buttonGesture tracks BTN1 and BTN2 being held together. The buttons are
+// active-low, so a pressed button reads 0. Readings without the buttons read
+// 0 as well, so the gesture is only armed after both were seen released.
+type buttonGesture struct {
+	armed bool
+	since time.Time
+}
+
+// update advances the gesture on a reading and reports whether the buttons
+// have now been held together long enough. The buttons must be released
+// before the gesture can complete again.
+func (g *buttonGesture) update(reading *models.SensorReading) bool {
+	switch {
+	case reading.Btn1 == 1 && reading.Btn2 == 1:
+		g.armed = true
+		g.since = time.Time{}
+		return false
+	case reading.Btn1 != 0 || reading.Btn2 != 0 || !g.armed:
+		g.since = time.Time{}
+		return false
+	}
+
+	if g.since.IsZero() {
+		g.since = reading.Timestamp
+		return false
+	}
+	if reading.Timestamp.Sub(g.since) < modeButtonHold {
+		return false
+	}
+
+	g.armed = false
+	g.since = time.Time{}
+	return true
+}
+
+// toggleMode switches the house between home and away after the mode
+// buttons were held. Any other mode switches back to home. It writes to the
+// database, so it runs off the serial read goroutine.
+func (a *ArduinoSerial) toggleMode() {
+	mode := models.ModeHome
+	if a.modeService.GetMode() == models.ModeHome {
+		mode = models.ModeAway
+	}
+
+	origin := models.Origin{Kind: models.OriginButton, ID: a.id}
+	if _, err := a.modeService.SetMode(mode, origin); err != nil {
+		log.Printf("Error switching house mode from %s buttons: %v", a.id, err)
+	}
+}
@@ -0,0 +1,118 @@
+package serial
+
+import "strings"
+
+// CommandPriority orders the command queue. Higher priorities are sent first;
+// commands of equal priority keep their order.
+type CommandPriority int
+
+// Command priority classes
+const (
+	PriorityLow    CommandPriority = -1 // convenience commands such as music
+	PriorityNormal CommandPriority = 0  // user commands
+	PrioritySafety CommandPriority = 1  // safety actions triggered by rules
+)
+
+// safetyCommands are rule actions that protect the house and jump the queue
+var safetyCommands = map[string]bool{
+	"buzzer_on":    true,
+	"window_close": true,
+	"fan_on":       true,
+}
+
+// musicCommands start playback on the buzzer pin
+var musicCommands = map[string]bool{
+	"play_birthday":   true,
+	"play_ode_to_joy": true,
+}
+
+// commandTargets maps commands to the actuator they drive. Queued commands
+// driving the same actuator are coalesced.
+var commandTargets = map[string]string{
+	"white_light_on":   "white_light",
+	"white_light_off":  "white_light",
+	"yellow_light_on":  "yellow_light",
+	"yellow_light_off": "yellow_light",
+	"relay_on":         "relay",
+	"relay_off":        "relay",
+	"door_open":        "door",
+	"door_close":       "door",
+	"window_open":      "window",
+	"window_close":     "window",
+	"fan_on":           "fan",
+	"fan_off":          "fan",
+	"buzzer_on":        "buzzer",
+	"buzzer_off":       "buzzer",
+	"play_birthday":    "music",
+	"play_ode_to_joy":  "music",
+	"stop_music":       "music",
+}
+
+// targetPrefixes maps parameterised commands to the actuator they drive
+var targetPrefixes = map[string]string{
+	"door_angle=":   "door",
+	"window_angle=": "window",
+	"fan_speed=":    "fan",
+}
+
+// rulePriority returns the priority of an action triggered by a rule
+func rulePriority(action string) CommandPriority {
+	if safetyCommands[action] {
+		return PrioritySafety
+	}
+	return PriorityNormal
+}
+
+// commandTarget returns the actuator a command drives, or "" when unknown
+func commandTarget(command string) string {
+	if target, ok := commandTargets[command]; ok {
+		return target
+	}
+	for prefix, target := range targetPrefixes {
+		if strings.HasPrefix(command, prefix) {
+			return target
+		}
+	}
+	return ""
+}
+
+// insertCommand places a command in the queue behind every command of equal
+// or higher priority, or in front of its priority class when requeued. Must
+// be called with the lock held.
+func (a *ArduinoSerial) insertCommand(cmd *pendingCommand, front bool) {
+	i := 0
+	for i < len(a.commandQueue) {
+		queued := a.commandQueue[i].priority
+		if queued < cmd.priority || (front && queued == cmd.priority) {
+			break
+		}
+		i++
+	}
+
+	a.commandQueue = append(a.commandQueue, nil)
+	copy(a.commandQueue[i+1:], a.commandQueue[i:])
+	a.commandQueue[i] = cmd
+}
+
+// coalesceCommands removes queued commands made obsolete by cmd: those
+// driving the same actuator at the same or lower priority and, for safety
+// commands, queued music. Must be called with the lock held; the caller
+// resolves the returned commands once the lock is released.
+func (a *ArduinoSerial) coalesceCommands(cmd *pendingCommand) []*pendingCommand {
+	target := commandTarget(cmd.command)
+
+	var superseded []*pendingCommand
+	kept := a.commandQueue[:0]
+	for _, queued := range a.commandQueue {
+		sameTarget := target != "" && commandTarget(queued.command) == target && queued.priority <= cmd.priority
+		preemptedMusic := cmd.priority == PrioritySafety && musicCommands[queued.command]
+		if sameTarget || preemptedMusic {
+			superseded = append(superseded, queued)
+			continue
+		}
+		kept = append(kept, queued)
+	}
+	a.commandQueue = kept
+
+	return superseded
+}
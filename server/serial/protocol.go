@@ -0,0 +1,251 @@
+package serial
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Line protocol versions. Version 1 is the unframed "KEY:value" format of
+// smarthome.ino. Version 2 wraps every line in a frame carrying the protocol
+// version, a sequence number and a checksum:
+//
+//	$2,<seq>,<payload>*<crc>
+//
+// The checksum covers everything before '*' and is either a CRC-8 (two hex
+// digits) or a CRC-16/CCITT (four hex digits). Version 2 is negotiated after
+// the board prints READY by sending "proto=2"; boards that answer with ERROR
+// stay on version 1.
+const (
+	ProtocolV1 = 1
+	ProtocolV2 = 2
+)
+
+// ProtocolStats reports the negotiated protocol and frame counters
+type ProtocolStats struct {
+	Version        int   `json:"version"`
+	FramesReceived int64 `json:"framesReceived"`
+	LegacyLines    int64 `json:"legacyLines"`
+	CorruptFrames  int64 `json:"corruptFrames"`
+	RejectedLines  int64 `json:"rejectedLines"`
+	SequenceGaps   int64 `json:"sequenceGaps"`
+	FramesSent     int64 `json:"framesSent"`
+	JSONMode       bool  `json:"jsonMode"`
+	JSONLines      int64 `json:"jsonLines"`
+}
+
+// protocolAckPrefix starts the board's reply to "proto=<version>"
+const protocolAckPrefix = "ACK: Protocol "
+
+// frame is a decoded version 2 frame
+type frame struct {
+	version int
+	seq     int
+	payload string
+}
+
+// encodeFrame wraps a payload in a version 2 frame. crcWidth is 8 or 16.
+func encodeFrame(seq int, payload string, crcWidth int) string {
+	body := fmt.Sprintf("$%d,%d,%s", ProtocolV2, seq, payload)
+	if crcWidth == 16 {
+		return fmt.Sprintf("%s*%04X", body, crc16([]byte(body)))
+	}
+	return fmt.Sprintf("%s*%02X", body, crc8([]byte(body)))
+}
+
+// isFrame reports whether a line looks like a version 2 frame
+func isFrame(line string) bool {
+	return strings.HasPrefix(line, "$")
+}
+
+// decodeFrame parses and verifies a version 2 frame
+func decodeFrame(line string) (*frame, error) {
+	star := strings.LastIndexByte(line, '*')
+	if !isFrame(line) || star < 0 {
+		return nil, fmt.Errorf("malformed frame")
+	}
+
+	body, checksum := line[:star], line[star+1:]
+	expected, err := strconv.ParseUint(checksum, 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("malformed checksum %q", checksum)
+	}
+
+	switch len(checksum) {
+	case 2:
+		if uint64(crc8([]byte(body))) != expected {
+			return nil, fmt.Errorf("CRC-8 mismatch")
+		}
+	case 4:
+		if uint64(crc16([]byte(body))) != expected {
+			return nil, fmt.Errorf("CRC-16 mismatch")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported checksum length %d", len(checksum))
+	}
+
+	fields := strings.SplitN(body[1:], ",", 3)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("malformed frame header")
+	}
+	version, err := strconv.Atoi(fields[0])
+	if err != nil || version != ProtocolV2 {
+		return nil, fmt.Errorf("unsupported protocol version %q", fields[0])
+	}
+	seq, err := strconv.Atoi(fields[1])
+	if err != nil || seq < 0 || seq > 255 {
+		return nil, fmt.Errorf("invalid sequence number %q", fields[1])
+	}
+
+	return &frame{version: version, seq: seq, payload: fields[2]}, nil
+}
+
+// crc8 computes a CRC-8 with polynomial 0x07
+func crc8(data []byte) uint8 {
+	var crc uint8
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// crc16 computes a CRC-16/CCITT-FALSE (polynomial 0x1021, initial 0xFFFF)
+func crc16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// decodeLine unwraps a received line, returning the payload and whether it
+// should be processed. Unframed lines are accepted as version 1 so older
+// boards keep working. Once version 2 is active they would bypass the
+// checksum, so only the READY banner of a reset board is let through.
+func (a *ArduinoSerial) decodeLine(line string) (string, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if !isFrame(line) {
+		if a.protocolStats.Version == ProtocolV2 && line != "READY" {
+			a.protocolStats.CorruptFrames++
+			log.Printf("Rejected unframed line %q on protocol v%d", line, ProtocolV2)
+			return "", false
+		}
+		a.protocolStats.LegacyLines++
+		return line, true
+	}
+
+	f, err := decodeFrame(line)
+	if err != nil {
+		a.protocolStats.CorruptFrames++
+		log.Printf("Rejected corrupt frame %q: %v", line, err)
+		return "", false
+	}
+
+	if a.lastRxSeq >= 0 && f.seq != (a.lastRxSeq+1)%256 {
+		a.protocolStats.SequenceGaps++
+	}
+	a.lastRxSeq = f.seq
+	a.protocolStats.FramesReceived++
+	return f.payload, true
+}
+
+// encodeCommand renders an outgoing command as a JSON line for boards that
+// speak JSON, and frames it when version 2 is active
+func (a *ArduinoSerial) encodeCommand(cmd *pendingCommand) string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	command := cmd.command
+	if a.protocolStats.JSONMode {
+		command = encodeJSONCommand(cmd)
+	}
+
+	if a.protocolStats.Version != ProtocolV2 {
+		return command
+	}
+
+	seq := a.txSeq
+	a.txSeq = (a.txSeq + 1) % 256
+	a.protocolStats.FramesSent++
+	return encodeFrame(seq, command, 8)
+}
+
+// resetProtocol falls back to version 1, as the board does after a reset
+func (a *ArduinoSerial) resetProtocol() {
+	a.protocolStats.Version = ProtocolV1
+	a.protocolStats.JSONMode = false
+	a.lastRxSeq = -1
+	a.txSeq = 0
+}
+
+// negotiateProtocol asks the board to switch to the preferred protocol
+// version. Boards that do not understand the request stay on version 1.
+func (a *ArduinoSerial) negotiateProtocol() {
+	a.mutex.RLock()
+	preferred := a.preferredProtocol
+	a.mutex.RUnlock()
+
+	if preferred != ProtocolV2 {
+		return
+	}
+
+	// The listener switches versions as soon as the acknowledgement arrives
+	// so that no command slips out unframed in between
+	result, err := a.SendCommandWithOptions(fmt.Sprintf("proto=%d", ProtocolV2), CommandOptions{Ephemeral: true})
+	if err != nil {
+		log.Printf("Protocol negotiation failed: %v", err)
+		return
+	}
+	if !result.OK() {
+		log.Printf("Board does not support protocol v%d (%s), using v%d", ProtocolV2, result.Status, ProtocolV1)
+		return
+	}
+	log.Printf("✓ Negotiated protocol v%d", ProtocolV2)
+}
+
+// applyProtocolAck switches the active version when the board acknowledges
+// a "proto=" command
+func (a *ArduinoSerial) applyProtocolAck(line string) {
+	if !strings.HasPrefix(line, protocolAckPrefix) {
+		return
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(line, protocolAckPrefix))
+	if err != nil || (version != ProtocolV1 && version != ProtocolV2) {
+		return
+	}
+
+	a.mutex.Lock()
+	a.protocolStats.Version = version
+	a.mutex.Unlock()
+}
+
+// SetPreferredProtocol sets the protocol version requested after READY
+func (a *ArduinoSerial) SetPreferredProtocol(version int) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.preferredProtocol = version
+}
+
+// GetProtocolStats returns the negotiated protocol and frame counters
+func (a *ArduinoSerial) GetProtocolStats() ProtocolStats {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.protocolStats
+}
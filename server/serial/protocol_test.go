@@ -0,0 +1,152 @@
+package serial
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCRC(t *testing.T) {
+	tests := []struct {
+		data  string
+		crc8  uint8
+		crc16 uint16
+	}{
+		{"", 0x00, 0xFFFF},
+		{"123456789", 0xF4, 0x29B1},
+		{"A", 0xC0, 0xB915},
+	}
+
+	for _, tt := range tests {
+		if got := crc8([]byte(tt.data)); got != tt.crc8 {
+			t.Errorf("crc8(%q) = %02X, want %02X", tt.data, got, tt.crc8)
+		}
+		if got := crc16([]byte(tt.data)); got != tt.crc16 {
+			t.Errorf("crc16(%q) = %04X, want %04X", tt.data, got, tt.crc16)
+		}
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		seq      int
+		payload  string
+		crcWidth int
+	}{
+		{0, "GAS:120", 8},
+		{255, "GAS:120", 16},
+		{17, "LIGHT:512", 8},
+		{42, "ACK: relay=1", 16},
+		{7, `{"gas":120,"light":512}`, 8},
+		{8, "MSG:a*b,c", 16},
+		{9, "", 8},
+	}
+
+	for _, tt := range tests {
+		line := encodeFrame(tt.seq, tt.payload, tt.crcWidth)
+		if !isFrame(line) {
+			t.Errorf("encodeFrame(%d, %q, %d) = %q, not a frame", tt.seq, tt.payload, tt.crcWidth, line)
+			continue
+		}
+		if digits := len(line) - strings.LastIndexByte(line, '*') - 1; digits != tt.crcWidth/4 {
+			t.Errorf("encodeFrame(%d, %q, %d) = %q, want %d checksum digits", tt.seq, tt.payload, tt.crcWidth, line, tt.crcWidth/4)
+		}
+
+		f, err := decodeFrame(line)
+		if err != nil {
+			t.Errorf("decodeFrame(%q) failed: %v", line, err)
+			continue
+		}
+		if f.version != ProtocolV2 || f.seq != tt.seq || f.payload != tt.payload {
+			t.Errorf("decodeFrame(%q) = %+v, want version %d, seq %d, payload %q", line, *f, ProtocolV2, tt.seq, tt.payload)
+		}
+	}
+}
+
+func TestDecodeFrameErrors(t *testing.T) {
+	valid8 := encodeFrame(3, "GAS:120", 8)
+	valid16 := encodeFrame(3, "GAS:120", 16)
+
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"unframed", "GAS:120"},
+		{"no checksum", "$2,3,GAS:120"},
+		{"corrupt payload, CRC-8", strings.Replace(valid8, "120", "121", 1)},
+		{"corrupt payload, CRC-16", strings.Replace(valid16, "120", "121", 1)},
+		{"corrupt sequence", strings.Replace(valid8, ",3,", ",4,", 1)},
+		{"corrupt checksum", fmt.Sprintf("$2,3,GAS:120*%02X", crc8([]byte("$2,3,GAS:120"))^0xFF)},
+		{"truncated", valid16[:len(valid16)-2]},
+		{"checksum not hex", "$2,3,GAS:120*ZZ"},
+		{"odd checksum length", "$2,3,GAS:120*ABC"},
+		{"missing payload", withCRC8("$2,3")},
+		{"unsupported version", withCRC8("$3,3,GAS:120")},
+		{"sequence not a number", withCRC8("$2,x,GAS:120")},
+		{"sequence out of range", withCRC8("$2,256,GAS:120")},
+		{"negative sequence", withCRC8("$2,-1,GAS:120")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if f, err := decodeFrame(tt.line); err == nil {
+				t.Errorf("decodeFrame(%q) = %+v, want an error", tt.line, *f)
+			}
+		})
+	}
+}
+
+// withCRC8 appends a valid CRC-8 to a frame body
+func withCRC8(body string) string {
+	return fmt.Sprintf("%s*%02X", body, crc8([]byte(body)))
+}
+
+func TestDecodeLine(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     int
+		line        string
+		wantPayload string
+		wantOK      bool
+		wantCorrupt int64
+	}{
+		{"v1 unframed", ProtocolV1, "GAS:120", "GAS:120", true, 0},
+		{"v1 frame", ProtocolV1, encodeFrame(0, "GAS:120", 8), "GAS:120", true, 0},
+		{"v2 frame", ProtocolV2, encodeFrame(0, "GAS:120", 16), "GAS:120", true, 0},
+		{"v2 corrupt frame", ProtocolV2, strings.Replace(encodeFrame(0, "GAS:120", 8), "120", "121", 1), "", false, 1},
+		{"v2 unframed", ProtocolV2, "GAS:120", "", false, 1},
+		{"v2 unframed ack", ProtocolV2, "ACK: relay=1", "", false, 1},
+		{"v2 ready after reset", ProtocolV2, "READY", "READY", true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewArduinoSerial("test", nil, nil, nil, nil, nil, nil, nil)
+			a.protocolStats.Version = tt.version
+
+			payload, ok := a.decodeLine(tt.line)
+			if payload != tt.wantPayload || ok != tt.wantOK {
+				t.Errorf("decodeLine(%q) = %q, %v, want %q, %v", tt.line, payload, ok, tt.wantPayload, tt.wantOK)
+			}
+			if got := a.GetProtocolStats().CorruptFrames; got != tt.wantCorrupt {
+				t.Errorf("CorruptFrames = %d, want %d", got, tt.wantCorrupt)
+			}
+		})
+	}
+}
+
+func TestDecodeLineSequenceGaps(t *testing.T) {
+	a := NewArduinoSerial("test", nil, nil, nil, nil, nil, nil, nil)
+	a.protocolStats.Version = ProtocolV2
+
+	for _, seq := range []int{254, 255, 0, 2, 3} {
+		if _, ok := a.decodeLine(encodeFrame(seq, "GAS:120", 8)); !ok {
+			t.Fatalf("decodeLine rejected frame %d", seq)
+		}
+	}
+
+	stats := a.GetProtocolStats()
+	if stats.FramesReceived != 5 || stats.SequenceGaps != 1 {
+		t.Errorf("FramesReceived = %d, SequenceGaps = %d, want 5 and 1", stats.FramesReceived, stats.SequenceGaps)
+	}
+}
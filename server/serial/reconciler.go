@@ -0,0 +1,146 @@
+package serial
+
+import (
+	"log"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+)
+
+// actuatorStatus returns the tracked status of a field, creating it on first
+// use. Must be called with the lock held.
+func (a *ArduinoSerial) actuatorStatus(field string) *models.ActuatorStatus {
+	status, ok := a.actuatorStatuses[field]
+	if !ok {
+		status = &models.ActuatorStatus{}
+		a.actuatorStatuses[field] = status
+	}
+	return status
+}
+
+// recordDesired records that a value was requested for a field. A new value
+// clears earlier resends unless the request is itself a resend. Must be
+// called with the lock held.
+func (a *ArduinoSerial) recordDesired(field string, value int, resend bool) {
+	status := a.actuatorStatus(field)
+	if !resend && (status.Desired == nil || *status.Desired != value || status.Unconfirmed) {
+		status.Resends = 0
+		status.Unconfirmed = false
+	}
+
+	now := time.Now()
+	status.Desired = &value
+	status.RequestedAt = &now
+}
+
+// recordReported records a value confirmed by the board and buffers an audit
+// event when it changed. Must be called with the lock held.
+func (a *ArduinoSerial) recordReported(field string, value int, command string, origin models.Origin) {
+	status := a.actuatorStatus(field)
+
+	now := time.Now()
+	if status.Reported == nil || *status.Reported != value {
+		a.actuatorEvents = append(a.actuatorEvents, models.ActuatorEvent{
+			DeviceID:  a.id,
+			Actuator:  field,
+			OldValue:  status.Reported,
+			NewValue:  value,
+			Command:   command,
+			Origin:    origin,
+			Timestamp: now,
+		})
+	}
+
+	status.Reported = &value
+	status.ConfirmedAt = &now
+	if status.InSync() {
+		status.Resends = 0
+		status.Unconfirmed = false
+	}
+
+	setStateField(a.actuatorStates, field, value)
+}
+
+// startReconciler periodically re-sends commands for actuators whose
+// reported state drifted from the desired one
+func (a *ArduinoSerial) startReconciler(stop <-chan bool) {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.reconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			a.reconcileActuators()
+		}
+	}
+}
+
+// reconcileActuators re-sends the desired value of every drifted actuator
+// that has no command queued. Actuators that stay unconfirmed after
+// maxResends are flagged and left alone until a new value is requested.
+func (a *ArduinoSerial) reconcileActuators() {
+	a.mutex.Lock()
+	var resends []string
+	for field, status := range a.actuatorStatuses {
+		if status.InSync() || status.Unconfirmed || time.Since(*status.RequestedAt) < a.reconcileGrace {
+			continue
+		}
+
+		command, ok := stateCommand(field, *status.Desired)
+		if !ok || a.targetQueued(commandTarget(command)) {
+			continue
+		}
+
+		if status.Resends >= a.maxResends {
+			status.Unconfirmed = true
+			log.Printf("⚠ %s on %s never confirmed %d after %d resend(s)", field, a.id, *status.Desired, status.Resends)
+			continue
+		}
+
+		status.Resends++
+		resends = append(resends, command)
+	}
+	a.mutex.Unlock()
+
+	for _, command := range resends {
+		log.Printf("Reconciling %s: re-sending '%s'", a.id, command)
+		go func(command string) {
+			result, err := a.SendCommandWithOptions(command, CommandOptions{
+				Ephemeral: true,
+				Origin:    models.Origin{Kind: models.OriginReconciler},
+				resend:    true,
+			})
+			if err == nil && !result.OK() {
+				log.Printf("Reconcile command '%s' finished with %s", command, result.Status)
+			}
+		}(command)
+	}
+}
+
+// targetQueued reports whether a command for the actuator target is waiting
+// in the queue. Must be called with the lock held.
+func (a *ArduinoSerial) targetQueued(target string) bool {
+	for _, cmd := range a.commandQueue {
+		if commandTarget(cmd.command) == target {
+			return true
+		}
+	}
+	return false
+}
+
+// GetActuatorStatuses returns the desired and reported state of every
+// actuator field that was requested or reported
+func (a *ArduinoSerial) GetActuatorStatuses() map[string]models.ActuatorStatus {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	statuses := make(map[string]models.ActuatorStatus, len(a.actuatorStatuses))
+	for field, status := range a.actuatorStatuses {
+		statuses[field] = *status
+	}
+	return statuses
+}
@@ -0,0 +1,156 @@
+package serial
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+	"github.com/caphefalumi/smart-home/services"
+)
+
+// deviceIDPattern restricts device IDs to URL- and Mongo-friendly names
+var deviceIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// DeviceOptions are applied to every device created by a registry
+type DeviceOptions struct {
+	PreferredProtocol int
+	TelemetryTimeout  time.Duration
+	CommandTTL        time.Duration
+	RestorePolicies   map[string]string // actuator name to restore policy
+}
+
+// DeviceInfo describes a registered device and its connection
+type DeviceInfo struct {
+	ID string `json:"id"`
+	ConnectionStatus
+}
+
+// Registry holds the boards served by this server, keyed by device ID
+type Registry struct {
+	devices             map[string]*ArduinoSerial
+	sensorService       *services.SensorService
+	ruleService         *services.RuleService
+	commandService      *services.CommandService
+	actuatorService     *services.ActuatorService
+	sceneService        *services.SceneService
+	modeService         *services.ModeService
+	notificationService *services.NotificationService
+	options             DeviceOptions
+	mutex               sync.RWMutex
+}
+
+// NewRegistry creates an empty device registry
+func NewRegistry(sensorService *services.SensorService, ruleService *services.RuleService, commandService *services.CommandService, actuatorService *services.ActuatorService, sceneService *services.SceneService, modeService *services.ModeService, notificationService *services.NotificationService, options DeviceOptions) *Registry {
+	return &Registry{
+		devices:             make(map[string]*ArduinoSerial),
+		sensorService:       sensorService,
+		ruleService:         ruleService,
+		commandService:      commandService,
+		actuatorService:     actuatorService,
+		sceneService:        sceneService,
+		modeService:         modeService,
+		notificationService: notificationService,
+		options:             options,
+	}
+}
+
+// Add registers a new, disconnected device
+func (r *Registry) Add(id string) (*ArduinoSerial, error) {
+	if !deviceIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("invalid device ID %q", id)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.devices[id]; exists {
+		return nil, fmt.Errorf("device %s already exists", id)
+	}
+
+	device := NewArduinoSerial(id, r.sensorService, r.ruleService, r.commandService, r.actuatorService, r.sceneService, r.modeService, r.notificationService)
+	device.SetPreferredProtocol(r.options.PreferredProtocol)
+	device.SetTelemetryTimeout(r.options.TelemetryTimeout)
+	device.SetCommandTTL(r.options.CommandTTL)
+	for actuator, policy := range r.options.RestorePolicies {
+		if err := device.SetRestorePolicy(actuator, policy); err != nil {
+			log.Printf("Ignoring restore policy for %s: %v", actuator, err)
+		}
+	}
+	r.devices[id] = device
+	return device, nil
+}
+
+// Get returns the device with the given ID
+func (r *Registry) Get(id string) (*ArduinoSerial, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	device, ok := r.devices[id]
+	return device, ok
+}
+
+// Remove disconnects a device and removes it from the registry. The default
+// device cannot be removed, and a device that fails to disconnect stays
+// registered so it can still be reached.
+func (r *Registry) Remove(id string) error {
+	if id == models.DefaultDeviceID {
+		return fmt.Errorf("the default device cannot be removed")
+	}
+
+	device, ok := r.Get(id)
+	if !ok {
+		return fmt.Errorf("device %s not found", id)
+	}
+	if err := device.Disconnect(); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	if r.devices[id] == device {
+		delete(r.devices, id)
+	}
+	r.mutex.Unlock()
+	return nil
+}
+
+// List returns every registered device sorted by ID
+func (r *Registry) List() []DeviceInfo {
+	r.mutex.RLock()
+	ids := make([]string, 0, len(r.devices))
+	for id := range r.devices {
+		ids = append(ids, id)
+	}
+	r.mutex.RUnlock()
+	sort.Strings(ids)
+
+	devices := make([]DeviceInfo, 0, len(ids))
+	for _, id := range ids {
+		if device, ok := r.Get(id); ok {
+			devices = append(devices, DeviceInfo{ID: id, ConnectionStatus: device.GetConnectionStatus()})
+		}
+	}
+	return devices
+}
+
+// DisconnectAll disconnects every registered device
+func (r *Registry) DisconnectAll() {
+	r.mutex.RLock()
+	devices := make([]*ArduinoSerial, 0, len(r.devices))
+	for _, device := range r.devices {
+		devices = append(devices, device)
+	}
+	r.mutex.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, device := range devices {
+		wg.Add(1)
+		go func(device *ArduinoSerial) {
+			defer wg.Done()
+			device.Disconnect()
+		}(device)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,115 @@
+package serial
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+)
+
+// Actuator restore policies applied when the board resets
+const (
+	RestoreRestore  = "restore"   // re-apply the last desired state
+	RestoreForceOff = "force-off" // switch the actuator off
+	RestoreLeave    = "leave"     // accept the state the board boots with
+)
+
+// defaultRestorePolicies keep the lights, relay and fan as they were, leave
+// the servos closed rather than move them unattended, and silence the buzzer
+var defaultRestorePolicies = map[string]string{
+	"white_light":  RestoreRestore,
+	"yellow_light": RestoreRestore,
+	"relay":        RestoreRestore,
+	"fan":          RestoreRestore,
+	"door":         RestoreLeave,
+	"window":       RestoreLeave,
+	"buzzer":       RestoreForceOff,
+}
+
+// SetRestorePolicy sets how an actuator is restored after the board resets
+func (a *ArduinoSerial) SetRestorePolicy(actuator, policy string) error {
+	if _, ok := actuators[actuator]; !ok {
+		return fmt.Errorf("unknown actuator %q", actuator)
+	}
+	switch policy {
+	case RestoreRestore, RestoreForceOff, RestoreLeave:
+	default:
+		return fmt.Errorf("invalid restore policy %q", policy)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.restorePolicies[actuator] = policy
+	return nil
+}
+
+// GetRestorePolicies returns the restore policy of every actuator
+func (a *ArduinoSerial) GetRestorePolicies() map[string]string {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	policies := make(map[string]string, len(a.restorePolicies))
+	for actuator, policy := range a.restorePolicies {
+		policies[actuator] = policy
+	}
+	return policies
+}
+
+// restoreActuators handles a board reset. Every output boots switched off
+// with both servos at 0, so the reported state is reset and each actuator is
+// restored according to its policy, oldest request first.
+func (a *ArduinoSerial) restoreActuators() {
+	type restore struct {
+		command     string
+		requestedAt time.Time
+	}
+
+	a.mutex.Lock()
+	var restores []restore
+	for field, actuator := range stateFields {
+		status, tracked := a.actuatorStatuses[field]
+		if tracked && status.Reported != nil {
+			a.recordReported(field, 0, "", models.Origin{Kind: models.OriginDevice, ID: "reset"})
+		}
+		setStateField(a.actuatorStates, field, 0)
+
+		switch a.restorePolicies[actuator] {
+		case RestoreRestore:
+			if !tracked || status.Desired == nil || *status.Desired == 0 {
+				continue
+			}
+			if command, ok := stateCommand(field, *status.Desired); ok {
+				restores = append(restores, restore{command, *status.RequestedAt})
+			}
+		case RestoreForceOff:
+			// Only the switch field sends a command; fan_speed follows fan
+			if command, ok := stateCommand(field, 0); ok && field == actuator {
+				restores = append(restores, restore{command, time.Time{}})
+			}
+		case RestoreLeave:
+			if tracked {
+				a.recordDesired(field, 0, false)
+			}
+		}
+	}
+	a.mutex.Unlock()
+
+	sort.Slice(restores, func(i, j int) bool { return restores[i].requestedAt.Before(restores[j].requestedAt) })
+
+	for _, r := range restores {
+		log.Printf("Restoring %s after reset: '%s'", a.id, r.command)
+		result, err := a.SendCommandWithOptions(r.command, CommandOptions{
+			Ephemeral: true,
+			Origin:    models.Origin{Kind: models.OriginRestore},
+		})
+		if err != nil {
+			log.Printf("Failed to restore '%s': %v", r.command, err)
+			continue
+		}
+		if !result.OK() {
+			log.Printf("Restore command '%s' finished with %s", r.command, result.Status)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package serial
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxActionDelay bounds a single delay step of a rule
+const maxActionDelay = 10 * time.Minute
+
+// melodyCommands map the melodies a rule can play to their commands
+var melodyCommands = map[string]string{
+	"birthday":   "play_birthday",
+	"ode_to_joy": "play_ode_to_joy",
+}
+
+// ValidateRuleActions checks every step of a rule's action sequence
+func ValidateRuleActions(actions []models.RuleAction) error {
+	if len(actions) == 0 {
+		return fmt.Errorf("at least one action is required")
+	}
+
+	for i, action := range actions {
+		if err := validateRuleAction(action); err != nil {
+			return fmt.Errorf("action %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// validateRuleAction checks a single step
+func validateRuleAction(action models.RuleAction) error {
+	switch action.OnError {
+	case "", models.OnErrorAbort, models.OnErrorContinue:
+	default:
+		return fmt.Errorf("invalid onError %q", action.OnError)
+	}
+	if err := models.ValidateModes(action.Modes); err != nil {
+		return err
+	}
+
+	switch action.Type {
+	case models.ActionCommand, models.ActionMelody:
+		_, err := actionCommand(action)
+		return err
+	case models.ActionDelay:
+		delay := time.Duration(action.DelayMs) * time.Millisecond
+		if delay <= 0 || delay > maxActionDelay {
+			return fmt.Errorf("delayMs must be between 1 and %d", maxActionDelay.Milliseconds())
+		}
+	case models.ActionNotify:
+		if action.Message == "" {
+			return fmt.Errorf("notify actions need a message")
+		}
+	case models.ActionEnableRule, models.ActionDisableRule:
+		if _, err := primitive.ObjectIDFromHex(action.RuleID); err != nil {
+			return fmt.Errorf("invalid rule ID %q", action.RuleID)
+		}
+	case models.ActionScene:
+		if _, err := primitive.ObjectIDFromHex(action.SceneID); err != nil {
+			return fmt.Errorf("invalid scene ID %q", action.SceneID)
+		}
+	case models.ActionSetMode:
+		return models.ValidateMode(action.Mode)
+	default:
+		return fmt.Errorf("unknown action type %q", action.Type)
+	}
+	return nil
+}
+
+// actionCommand renders the firmware command of a command or melody step
+func actionCommand(action models.RuleAction) (string, error) {
+	if action.Type == models.ActionMelody {
+		command, ok := melodyCommands[action.Melody]
+		if !ok {
+			return "", fmt.Errorf("unknown melody %q", action.Melody)
+		}
+		return command, nil
+	}
+
+	if action.Actuator == "" {
+		if action.Command == "" {
+			return "", fmt.Errorf("command actions need a command or an actuator")
+		}
+		return action.Command, ValidateCommand(action.Command)
+	}
+	if action.Command != "" {
+		return "", fmt.Errorf("command actions take a command or an actuator, not both")
+	}
+
+	actuator, ok := actuators[action.Actuator]
+	if !ok {
+		return "", fmt.Errorf("unknown actuator %q", action.Actuator)
+	}
+	return actuator.Command(ActuatorSetting{On: action.On, Angle: action.Angle, Speed: action.Speed})
+}
+
+// runRuleActions runs the action sequence of a rule that fired
+func (a *ArduinoSerial) runRuleActions(triggered models.TriggeredAction) {
+	a.RunActions(models.Origin{Kind: models.OriginRule, ID: triggered.RuleID}, triggered.Actions)
+}
+
+// RunActions runs an action sequence on behalf of origin. A failed step
+// stops the sequence unless it is marked to continue on error, and delays
+// end early when the device is disconnected. Steps scoped to other house
+// modes than the current one are skipped. It returns the error of the
+// step that stopped the sequence, or else of the last step that failed.
+func (a *ArduinoSerial) RunActions(origin models.Origin, actions []models.RuleAction) error {
+	a.mutex.RLock()
+	stop := a.supervisorStop
+	a.mutex.RUnlock()
+
+	var failed error
+	for i, action := range actions {
+		if !models.InModes(action.Modes, a.modeService.GetMode()) {
+			continue
+		}
+		if action.Type == models.ActionDelay {
+			select {
+			case <-stop:
+				log.Printf("%s %s stopped at step %d: device disconnected", origin.Kind, origin.ID, i+1)
+				return fmt.Errorf("step %d: device disconnected", i+1)
+			case <-time.After(time.Duration(action.DelayMs) * time.Millisecond):
+			}
+			continue
+		}
+
+		err := a.runAction(origin, action)
+		if err == nil {
+			continue
+		}
+
+		log.Printf("%s %s step %d (%s) failed: %v", origin.Kind, origin.ID, i+1, action.Type, err)
+		failed = fmt.Errorf("step %d (%s): %w", i+1, action.Type, err)
+		if action.OnError != models.OnErrorContinue {
+			return failed
+		}
+	}
+	return failed
+}
+
+// runAction runs a single step other than a delay
+func (a *ArduinoSerial) runAction(origin models.Origin, action models.RuleAction) error {
+	switch action.Type {
+	case models.ActionCommand, models.ActionMelody:
+		command, err := actionCommand(action)
+		if err != nil {
+			return err
+		}
+
+		options := CommandOptions{
+			Priority: rulePriority(command),
+			Origin:   origin,
+		}
+		if action.Type == models.ActionMelody {
+			// Songs are not persisted, so a song is never replayed after a restart
+			options.Priority = PriorityLow
+			options.Ephemeral = true
+		}
+
+		log.Printf("Executing action '%s'", command)
+		result, err := a.SendCommandWithOptions(command, options)
+		if err != nil {
+			return err
+		}
+		if !result.OK() && result.Status != CommandQueued {
+			return fmt.Errorf("'%s' was not acknowledged: %s %s", command, result.Status, result.Reply)
+		}
+		return nil
+
+	case models.ActionNotify:
+		return a.notify(origin, action.Message)
+
+	case models.ActionEnableRule, models.ActionDisableRule:
+		enabled := action.Type == models.ActionEnableRule
+		if _, err := a.ruleService.UpdateRule(action.RuleID, map[string]interface{}{"enabled": enabled}); err != nil {
+			return err
+		}
+		log.Printf("%s %s set rule %s enabled=%t", origin.Kind, origin.ID, action.RuleID, enabled)
+		return nil
+
+	case models.ActionScene:
+		scene, err := a.sceneService.GetScene(action.SceneID)
+		if err != nil {
+			return fmt.Errorf("scene %s: %w", action.SceneID, err)
+		}
+		for _, cmd := range a.ActivateScene(scene, origin).Commands {
+			if cmd.Status != CommandSucceeded && cmd.Status != CommandQueued {
+				return fmt.Errorf("scene %s: '%s' finished with %s", scene.Name, cmd.Command, cmd.Status)
+			}
+		}
+		return nil
+
+	case models.ActionSetMode:
+		_, err := a.modeService.SetMode(action.Mode, origin)
+		return err
+	}
+
+	return fmt.Errorf("unknown action type %q", action.Type)
+}
+
+// notify records a notification message on behalf of origin
+func (a *ArduinoSerial) notify(origin models.Origin, message string) error {
+	log.Printf("🔔 %s: %s", a.id, message)
+
+	return a.notificationService.SaveNotification(&models.Notification{
+		DeviceID:  a.id,
+		Message:   message,
+		Origin:    origin,
+		Timestamp: time.Now(),
+	})
+}
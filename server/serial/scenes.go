@@ -0,0 +1,173 @@
+package serial
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/caphefalumi/smart-home/models"
+)
+
+// SceneCommand is the outcome of a command sent to activate a scene
+type SceneCommand struct {
+	Field   string `json:"field"`
+	Command string `json:"command"`
+	Status  string `json:"status"`
+	Reply   string `json:"reply,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// SceneActivation reports the commands a scene needed and the fields that
+// were already in the target state
+type SceneActivation struct {
+	Commands  []SceneCommand `json:"commands"`
+	Unchanged []string       `json:"unchanged"`
+}
+
+// ParseSceneStates validates the target states of a scene, given as booleans
+// for switches and integers for angles and speeds
+func ParseSceneStates(states map[string]interface{}) (map[string]int, error) {
+	if len(states) == 0 {
+		return nil, fmt.Errorf("a scene needs at least one actuator state")
+	}
+
+	parsed := make(map[string]int, len(states))
+	for field, value := range states {
+		if _, _, err := ParseStateField(field, value); err != nil {
+			return nil, err
+		}
+		switch v := value.(type) {
+		case bool:
+			if v {
+				parsed[field] = 1
+			} else {
+				parsed[field] = 0
+			}
+		case float64:
+			parsed[field] = int(v)
+		}
+	}
+	return parsed, nil
+}
+
+// SnapshotScene returns the reported state of the given fields of
+// ActuatorStates, or of all of them when none are given. fan_on/fan_off and
+// fan_speed drive the same output, so only the fan field confirmed last is
+// kept.
+func (a *ArduinoSerial) SnapshotScene(fields []string) (map[string]int, error) {
+	if len(fields) == 0 {
+		for field := range stateFields {
+			fields = append(fields, field)
+		}
+	}
+
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	states := make(map[string]int, len(fields))
+	for _, field := range fields {
+		value, ok := a.actuatorStates.Value(field)
+		if !ok {
+			return nil, fmt.Errorf("unknown actuator %q", field)
+		}
+		states[field] = int(value)
+	}
+
+	_, hasFan := states["fan"]
+	_, hasSpeed := states["fan_speed"]
+	if hasFan && hasSpeed {
+		if a.confirmedAfter("fan_speed", "fan") {
+			delete(states, "fan")
+		} else {
+			delete(states, "fan_speed")
+		}
+	}
+	return states, nil
+}
+
+// ActivateScene sends the commands that bring the actuators to the states of
+// a scene, skipping those already there, and waits for their results
+func (a *ArduinoSerial) ActivateScene(scene *models.Scene, origin models.Origin) *SceneActivation {
+	activation := &SceneActivation{Commands: []SceneCommand{}, Unchanged: []string{}}
+
+	a.mutex.RLock()
+	for _, field := range sceneFields(scene.States) {
+		value := scene.States[field]
+		command, ok := stateCommand(field, value)
+		if !ok {
+			continue
+		}
+		if a.fieldAt(field, value) && !a.targetQueued(commandTarget(command)) {
+			activation.Unchanged = append(activation.Unchanged, field)
+			continue
+		}
+		activation.Commands = append(activation.Commands, SceneCommand{Field: field, Command: command})
+	}
+	a.mutex.RUnlock()
+
+	log.Printf("Activating scene %s on %s: %d command(s), %d unchanged",
+		scene.Name, a.id, len(activation.Commands), len(activation.Unchanged))
+
+	for i := range activation.Commands {
+		cmd := &activation.Commands[i]
+		result, err := a.SendCommandWithOptions(cmd.Command, CommandOptions{Origin: origin})
+		if err != nil {
+			cmd.Status = "error"
+			cmd.Error = err.Error()
+			continue
+		}
+		cmd.Status = result.Status
+		cmd.Reply = result.Reply
+	}
+	return activation
+}
+
+// confirmedAfter reports whether the board confirmed field after other. Must
+// be called with the lock held.
+func (a *ArduinoSerial) confirmedAfter(field, other string) bool {
+	status, ok := a.actuatorStatuses[field]
+	if !ok || status.ConfirmedAt == nil {
+		return false
+	}
+	otherStatus, ok := a.actuatorStatuses[other]
+	return !ok || otherStatus.ConfirmedAt == nil || status.ConfirmedAt.After(*otherStatus.ConfirmedAt)
+}
+
+// sceneFields returns the fields of a scene in a stable order. A scene
+// setting both fan fields sends a single fan command: off when the fan is
+// off, and the speed otherwise.
+func sceneFields(states map[string]int) []string {
+	fields := make([]string, 0, len(states))
+	for field := range states {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	fan, hasFan := states["fan"]
+	_, hasSpeed := states["fan_speed"]
+	if !hasFan || !hasSpeed {
+		return fields
+	}
+
+	drop := "fan"
+	if fan == 0 {
+		drop = "fan_speed"
+	}
+	kept := fields[:0]
+	for _, field := range fields {
+		if field != drop {
+			kept = append(kept, field)
+		}
+	}
+	return kept
+}
+
+// fieldAt reports whether a field is confirmed at a value and no other value
+// is requested for it. Must be called with the lock held.
+func (a *ArduinoSerial) fieldAt(field string, value int) bool {
+	if status, ok := a.actuatorStatuses[field]; ok && status.Desired != nil && *status.Desired != value {
+		return false
+	}
+	current, ok := a.actuatorStates.Value(field)
+	return ok && int(current) == value
+}
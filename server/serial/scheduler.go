@@ -0,0 +1,151 @@
+package serial
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+	"github.com/caphefalumi/smart-home/services"
+)
+
+// schedulerPoll bounds how long the scheduler sleeps between checks
+const schedulerPoll = time.Minute
+
+// Scheduler runs the action sequences of stored schedules on their devices
+type Scheduler struct {
+	devices         *Registry
+	scheduleService *services.ScheduleService
+	modeService     *services.ModeService
+	wake            chan struct{}
+	stop            chan struct{}
+	wg              sync.WaitGroup
+}
+
+// NewScheduler creates a scheduler for the devices of a registry
+func NewScheduler(devices *Registry, scheduleService *services.ScheduleService, modeService *services.ModeService) *Scheduler {
+	return &Scheduler{
+		devices:         devices,
+		scheduleService: scheduleService,
+		modeService:     modeService,
+		wake:            make(chan struct{}, 1),
+		stop:            make(chan struct{}),
+	}
+}
+
+// Start starts the scheduler. Runs that fell due while the server was down
+// are handled according to each schedule's missed-run policy.
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go s.loop()
+}
+
+// Stop stops the scheduler. Sequences already running are not interrupted.
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// Reload makes the scheduler pick up created, changed or deleted schedules
+func (s *Scheduler) Reload() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop runs due schedules and sleeps until the next one
+func (s *Scheduler) loop() {
+	defer s.wg.Done()
+
+	for {
+		wait := s.runDue(time.Now())
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-s.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// runDue starts every schedule that is due at now and returns how long to
+// wait for the next one
+func (s *Scheduler) runDue(now time.Time) time.Duration {
+	schedules, err := s.scheduleService.GetSchedules("")
+	if err != nil {
+		log.Printf("Scheduler: %v", err)
+		return schedulerPoll
+	}
+
+	wait := schedulerPoll
+	for i := range schedules {
+		schedule := &schedules[i]
+		if !schedule.Enabled || schedule.NextRunAt == nil {
+			continue
+		}
+
+		if until := schedule.NextRunAt.Sub(now); until > 0 {
+			if until < wait {
+				wait = until
+			}
+			continue
+		}
+
+		s.runSchedule(schedule, now)
+	}
+	return wait
+}
+
+// runSchedule advances a due schedule to its next run and then runs it. The
+// run is recorded as missed when it is too late and the policy says to skip
+// it, and as skipped when the house is not in one of the schedule's modes.
+func (s *Scheduler) runSchedule(schedule *models.Schedule, now time.Time) {
+	due := *schedule.NextRunAt
+	next := services.NextRun(schedule, now)
+	if err := s.scheduleService.SetNextRun(schedule.ID, next); err != nil {
+		log.Printf("Scheduler: %v", err)
+		return
+	}
+
+	if services.IsMissed(schedule, due, now) {
+		log.Printf("Schedule %s missed its run at %s", schedule.Name, due.Format(time.RFC3339))
+		if err := s.scheduleService.RecordRun(schedule.ID, due, models.RunMissed, ""); err != nil {
+			log.Printf("Scheduler: %v", err)
+		}
+		return
+	}
+
+	if mode := s.modeService.GetMode(); !models.InModes(schedule.Modes, mode) {
+		log.Printf("Schedule %s skipped in %s mode", schedule.Name, mode)
+		if err := s.scheduleService.RecordRun(schedule.ID, now, models.RunSkipped, ""); err != nil {
+			log.Printf("Scheduler: %v", err)
+		}
+		return
+	}
+
+	device, ok := s.devices.Get(schedule.DeviceID)
+	if !ok {
+		log.Printf("Schedule %s targets unknown device %s", schedule.Name, schedule.DeviceID)
+		if err := s.scheduleService.RecordRun(schedule.ID, now, models.RunFailed, "device not found"); err != nil {
+			log.Printf("Scheduler: %v", err)
+		}
+		return
+	}
+
+	log.Printf("Running schedule %s on %s", schedule.Name, schedule.DeviceID)
+	go func(schedule models.Schedule) {
+		result, message := models.RunOK, ""
+		origin := models.Origin{Kind: models.OriginSchedule, ID: schedule.ID.Hex()}
+		if err := device.RunActions(origin, schedule.Actions); err != nil {
+			result, message = models.RunFailed, err.Error()
+		}
+		if err := s.scheduleService.RecordRun(schedule.ID, now, result, message); err != nil {
+			log.Printf("Scheduler: %v", err)
+		}
+	}(*schedule)
+}
@@ -0,0 +1,385 @@
+package serial
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Simulator scenarios
+const (
+	ScenarioNormal  = "normal"
+	ScenarioGasLeak = "gas_leak"
+	ScenarioRain    = "rain"
+	ScenarioDusk    = "dusk"
+)
+
+// Scenarios lists the scripted scenarios supported by the simulator
+var Scenarios = []string{ScenarioNormal, ScenarioGasLeak, ScenarioRain, ScenarioDusk}
+
+// Simulator is an in-process virtual board that speaks the same line
+// protocol as smarthome.ino. It implements Transport so the whole server
+// can run without hardware.
+type Simulator struct {
+	scenario       string
+	scenarioStart  time.Time
+	sensorInterval time.Duration
+	replies        chan string
+	done           chan struct{}
+	reader         *io.PipeReader
+	writer         *io.PipeWriter
+	pending        string
+	protocol       int
+	txSeq          int
+	isOpen         bool
+	mutex          sync.Mutex
+	wg             sync.WaitGroup
+
+	// Simulated outputs, mirroring the pins driven by the firmware
+	whiteLight  bool
+	yellowLight bool
+	relay       bool
+	fan         bool
+	fanSpeed    int
+	buzzer      bool
+	doorAngle   int
+	windowAngle int
+	music       string
+}
+
+// NewSimulator creates a simulator running the given scenario
+func NewSimulator(scenario string) *Simulator {
+	if scenario == "" {
+		scenario = ScenarioNormal
+	}
+	return &Simulator{
+		scenario:       scenario,
+		sensorInterval: time.Second,
+	}
+}
+
+// Open starts the simulated board
+func (s *Simulator) Open() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.isOpen {
+		return fmt.Errorf("simulator is already running")
+	}
+	if !isValidScenario(s.scenario) {
+		return fmt.Errorf("unknown simulator scenario: %s", s.scenario)
+	}
+
+	s.reader, s.writer = io.Pipe()
+	s.replies = make(chan string, 32)
+	s.done = make(chan struct{})
+	s.scenarioStart = time.Now()
+	s.pending = ""
+	s.protocol = ProtocolV1
+	s.txSeq = 0
+	s.isOpen = true
+
+	s.wg.Add(1)
+	go s.run(s.writer, s.replies, s.done)
+	return nil
+}
+
+// Close stops the simulated board
+func (s *Simulator) Close() error {
+	s.mutex.Lock()
+	if !s.isOpen {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.isOpen = false
+	close(s.done)
+	writer := s.writer
+	s.mutex.Unlock()
+
+	writer.CloseWithError(io.EOF)
+	s.wg.Wait()
+	return nil
+}
+
+// Read reads the lines emitted by the simulated board
+func (s *Simulator) Read(p []byte) (int, error) {
+	s.mutex.Lock()
+	reader := s.reader
+	s.mutex.Unlock()
+
+	if reader == nil {
+		return 0, io.EOF
+	}
+	return reader.Read(p)
+}
+
+// Write delivers newline-terminated commands to the simulated board
+func (s *Simulator) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.isOpen {
+		return 0, fmt.Errorf("simulator is not running")
+	}
+
+	s.pending += string(p)
+	for {
+		idx := strings.IndexByte(s.pending, '\n')
+		if idx < 0 {
+			break
+		}
+		command := strings.TrimSpace(s.pending[:idx])
+		s.pending = s.pending[idx+1:]
+		if command == "" {
+			continue
+		}
+		if isFrame(command) {
+			f, err := decodeFrame(command)
+			if err != nil {
+				s.queueReply("ERROR: " + err.Error())
+				continue
+			}
+			command = f.payload
+		}
+		s.queueReply(s.processCommand(command))
+	}
+
+	return len(p), nil
+}
+
+// queueReply hands a reply to the run loop so Write never blocks on the
+// reader. Must be called with the mutex held.
+func (s *Simulator) queueReply(reply string) {
+	if reply == "" {
+		return
+	}
+	select {
+	case s.replies <- reply:
+	default:
+	}
+}
+
+// frameLine wraps an outgoing line when protocol v2 has been negotiated
+func (s *Simulator) frameLine(line string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.protocol != ProtocolV2 {
+		return line
+	}
+	seq := s.txSeq
+	s.txSeq = (s.txSeq + 1) % 256
+	return encodeFrame(seq, line, 16)
+}
+
+// Info returns the transport description
+func (s *Simulator) Info() TransportInfo {
+	return TransportInfo{Kind: TransportSimulator, Address: s.Scenario()}
+}
+
+// Scenario returns the active scenario name
+func (s *Simulator) Scenario() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.scenario
+}
+
+// SetScenario switches the scripted scenario and restarts its timeline
+func (s *Simulator) SetScenario(scenario string) error {
+	if !isValidScenario(scenario) {
+		return fmt.Errorf("unknown simulator scenario: %s", scenario)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.scenario = scenario
+	s.scenarioStart = time.Now()
+	return nil
+}
+
+// run emits the READY banner, periodic sensor lines and command replies
+func (s *Simulator) run(writer *io.PipeWriter, replies <-chan string, done <-chan struct{}) {
+	defer s.wg.Done()
+
+	if _, err := writer.Write([]byte("READY\n")); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(s.sensorInterval)
+	defer ticker.Stop()
+
+	for {
+		var line string
+		select {
+		case <-done:
+			return
+		case reply := <-replies:
+			line = reply
+		case <-ticker.C:
+			line = s.sensorLine()
+		}
+
+		if _, err := writer.Write([]byte(s.frameLine(line) + "\n")); err != nil {
+			return
+		}
+	}
+}
+
+// sensorLine renders the current scenario values in the firmware format
+func (s *Simulator) sensorLine() string {
+	s.mutex.Lock()
+	scenario := s.scenario
+	elapsed := time.Since(s.scenarioStart).Seconds()
+	s.mutex.Unlock()
+
+	gas, light, soil, water := 120.0, 650.0, 30.0, 100.0
+	switch scenario {
+	case ScenarioGasLeak:
+		// Gas ramps from background to well above the danger threshold in a minute
+		gas = ramp(120, 900, elapsed, 60)
+	case ScenarioRain:
+		water = ramp(100, 900, elapsed, 30)
+	case ScenarioDusk:
+		light = ramp(650, 150, elapsed, 120)
+	}
+
+	return fmt.Sprintf("GAS:%d,LIGHT:%d,SOIL:%d,WATER:%d,INFRAR:%d,BTN1:%d,BTN2:%d",
+		jitter(gas, 5), jitter(light, 10), jitter(soil, 2), jitter(water, 5), 1, 1, 1)
+}
+
+// processCommand applies a command and returns the firmware's reply. Must be
+// called with the mutex held.
+func (s *Simulator) processCommand(cmd string) string {
+	switch cmd {
+	case "white_light_on":
+		s.whiteLight = true
+		return "ACK: White light ON"
+	case "white_light_off":
+		s.whiteLight = false
+		return "ACK: White light OFF"
+	case "yellow_light_on":
+		s.yellowLight = true
+		return "ACK: Yellow light ON"
+	case "yellow_light_off":
+		s.yellowLight = false
+		return "ACK: Yellow light OFF"
+	case "relay_on":
+		s.relay = true
+		return "ACK: Relay ON"
+	case "relay_off":
+		s.relay = false
+		return "ACK: Relay OFF"
+	case "door_open":
+		s.doorAngle = 180
+		return "ACK: Door opened"
+	case "door_close":
+		s.doorAngle = 0
+		return "ACK: Door closed"
+	case "window_open":
+		s.windowAngle = 180
+		return "ACK: Window opened"
+	case "window_close":
+		s.windowAngle = 0
+		return "ACK: Window closed"
+	case "fan_on":
+		s.fan = true
+		return "ACK: Fan ON"
+	case "fan_off":
+		s.fan = false
+		return "ACK: Fan OFF"
+	case "buzzer_on":
+		s.buzzer = true
+		return "ACK: Buzzer ON"
+	case "buzzer_off":
+		s.buzzer = false
+		return "ACK: Buzzer OFF"
+	case "play_birthday":
+		s.music = "birthday"
+		return "ACK: Starting birthday song"
+	case "play_ode_to_joy":
+		s.music = "ode_to_joy"
+		return "ACK: Starting Ode to Joy"
+	case "stop_music":
+		s.music = ""
+		return "ACK: Music stopped"
+	}
+
+	// Protocol negotiation is only understood by v2-capable firmware
+	if value, ok := commandValue(cmd, "proto="); ok {
+		if value != ProtocolV1 && value != ProtocolV2 {
+			return "ERROR: " + cmd
+		}
+		s.protocol = value
+		return fmt.Sprintf("%s%d", protocolAckPrefix, value)
+	}
+
+	// Like the firmware, out-of-range values are silently ignored
+	if value, ok := commandValue(cmd, "door_angle="); ok {
+		if value < 0 || value > 180 {
+			return ""
+		}
+		s.doorAngle = value
+		return fmt.Sprintf("ACK: Door angle: %d", value)
+	}
+	if value, ok := commandValue(cmd, "window_angle="); ok {
+		if value < 0 || value > 180 {
+			return ""
+		}
+		s.windowAngle = value
+		return fmt.Sprintf("ACK: Window angle: %d", value)
+	}
+	if value, ok := commandValue(cmd, "fan_speed="); ok {
+		if value < 0 || value > 255 {
+			return ""
+		}
+		s.fanSpeed = value
+		return fmt.Sprintf("ACK: Fan speed: %d", value)
+	}
+
+	return "ERROR: " + cmd
+}
+
+// commandValue parses the integer argument of a "name=value" command. Like
+// Arduino's String.toInt, a malformed value is read as 0.
+func commandValue(cmd, prefix string) (int, bool) {
+	if !strings.HasPrefix(cmd, prefix) {
+		return 0, false
+	}
+	value, _ := strconv.Atoi(strings.TrimSpace(cmd[len(prefix):]))
+	return value, true
+}
+
+// ramp interpolates linearly from start to end over the given seconds
+func ramp(start, end, elapsed, seconds float64) float64 {
+	if elapsed >= seconds {
+		return end
+	}
+	return start + (end-start)*elapsed/seconds
+}
+
+// jitter adds noise and clamps the result to the 10-bit ADC range
+func jitter(value, amount float64) int {
+	v := int(value + (rand.Float64()*2-1)*amount)
+	if v < 0 {
+		return 0
+	}
+	if v > 1023 {
+		return 1023
+	}
+	return v
+}
+
+// isValidScenario reports whether the scenario name is known
+func isValidScenario(scenario string) bool {
+	for _, name := range Scenarios {
+		if name == scenario {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,249 @@
+package serial
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Connection states
+const (
+	StateDisconnected = "disconnected"
+	StateConnecting   = "connecting"
+	StateConnected    = "connected"
+	StateReconnecting = "reconnecting"
+)
+
+// maxStateTransitions bounds the transition history kept in memory
+const maxStateTransitions = 50
+
+// StateTransition records a change of connection state
+type StateTransition struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Reason    string    `json:"reason"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ConnectionStatus describes the link to the board
+type ConnectionStatus struct {
+	State             string            `json:"state"`
+	Since             time.Time         `json:"since"`
+	Transport         *TransportInfo    `json:"transport,omitempty"`
+	LastTelemetry     *time.Time        `json:"lastTelemetry,omitempty"`
+	ReconnectAttempts int               `json:"reconnectAttempts"`
+	QueuedCommands    int               `json:"queuedCommands"`
+	Transitions       []StateTransition `json:"transitions"`
+}
+
+// setState records a state transition. Must be called with the mutex held.
+func (a *ArduinoSerial) setState(state, reason string) {
+	if a.state == state {
+		return
+	}
+
+	transition := StateTransition{
+		From:      a.state,
+		To:        state,
+		Reason:    reason,
+		Timestamp: time.Now(),
+	}
+	a.transitions = append(a.transitions, transition)
+	if len(a.transitions) > maxStateTransitions {
+		a.transitions = a.transitions[len(a.transitions)-maxStateTransitions:]
+	}
+
+	a.state = state
+	a.stateSince = transition.Timestamp
+	log.Printf("Connection %s → %s (%s)", transition.From, transition.To, reason)
+}
+
+// startSession starts the goroutines serving an open transport. Must be
+// called with the mutex held.
+func (a *ArduinoSerial) startSession(transport Transport) {
+	stop := make(chan bool)
+	a.stopChan = stop
+	a.lastTelemetry = time.Now()
+	a.resetProtocol()
+
+	// Discard a link loss reported by the previous session
+	select {
+	case <-a.linkLost:
+	default:
+	}
+
+	a.wg.Add(5)
+	go a.startDataListener(transport, stop)
+	go a.startDataSaver(stop)
+	go a.startCommandDispatcher(transport, stop)
+	go a.startLinkWatchdog(stop)
+	go a.startReconciler(stop)
+
+	// Commands queued while the link was down are sent now
+	if len(a.commandQueue) > 0 {
+		select {
+		case a.queueSignal <- struct{}{}:
+		default:
+		}
+	}
+
+	a.setState(StateConnected, "link established")
+}
+
+// stopSession signals the session goroutines and closes the transport so
+// blocked reads return. Must be called with the mutex held.
+func (a *ArduinoSerial) stopSession() {
+	select {
+	case <-a.stopChan:
+		// Channel already closed
+	default:
+		close(a.stopChan)
+	}
+
+	if a.transport != nil {
+		a.transport.Close()
+	}
+}
+
+// reportLinkLost tells the supervisor that the link stopped working
+func (a *ArduinoSerial) reportLinkLost(reason string) {
+	select {
+	case a.linkLost <- reason:
+	default:
+	}
+}
+
+// supervise watches for link loss and reopens the transport until the
+// connection is closed with Disconnect
+func (a *ArduinoSerial) supervise(transport Transport, stop <-chan bool) {
+	defer a.supervisorWg.Done()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case reason := <-a.linkLost:
+			a.mutex.Lock()
+			select {
+			case <-stop:
+				a.mutex.Unlock()
+				return
+			default:
+			}
+			a.stopSession()
+			a.setState(StateReconnecting, reason)
+			a.mutex.Unlock()
+
+			a.wg.Wait()
+			if !a.reconnect(transport, stop) {
+				return
+			}
+		}
+	}
+}
+
+// reconnect reopens the transport with exponential backoff. It returns false
+// when the connection was closed while retrying.
+func (a *ArduinoSerial) reconnect(transport Transport, stop <-chan bool) bool {
+	backoff := a.reconnectBackoff
+
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-stop:
+			return false
+		case <-time.After(backoff):
+		}
+
+		a.mutex.Lock()
+		a.reconnectAttempts = attempt
+		a.mutex.Unlock()
+
+		if err := transport.Open(); err != nil {
+			log.Printf("Reconnect attempt %d failed: %v", attempt, err)
+			backoff *= 2
+			if backoff > a.maxReconnectBackoff {
+				backoff = a.maxReconnectBackoff
+			}
+			continue
+		}
+
+		// Wait for Arduino to reset
+		select {
+		case <-stop:
+			transport.Close()
+			return false
+		case <-time.After(2 * time.Second):
+		}
+
+		a.mutex.Lock()
+		select {
+		case <-stop:
+			a.mutex.Unlock()
+			transport.Close()
+			return false
+		default:
+		}
+		a.reconnectAttempts = 0
+		a.startSession(transport)
+		a.mutex.Unlock()
+
+		log.Printf("✓ Reconnected to Arduino after %d attempt(s)", attempt)
+		return true
+	}
+}
+
+// startLinkWatchdog reports link loss when telemetry stops arriving
+func (a *ArduinoSerial) startLinkWatchdog(stop <-chan bool) {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			a.mutex.RLock()
+			silence := time.Since(a.lastTelemetry)
+			timeout := a.telemetryTimeout
+			a.mutex.RUnlock()
+
+			if timeout > 0 && silence > timeout {
+				a.reportLinkLost(fmt.Sprintf("no telemetry for %s", silence.Round(time.Second)))
+				return
+			}
+		}
+	}
+}
+
+// SetTelemetryTimeout sets how long the link may stay silent before it is
+// considered lost. Zero disables the check.
+func (a *ArduinoSerial) SetTelemetryTimeout(timeout time.Duration) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.telemetryTimeout = timeout
+}
+
+// GetConnectionStatus returns the connection state and recent transitions
+func (a *ArduinoSerial) GetConnectionStatus() ConnectionStatus {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	status := ConnectionStatus{
+		State:             a.state,
+		Since:             a.stateSince,
+		ReconnectAttempts: a.reconnectAttempts,
+		QueuedCommands:    len(a.commandQueue),
+		Transitions:       append([]StateTransition{}, a.transitions...),
+	}
+	if a.transport != nil {
+		info := a.transport.Info()
+		status.Transport = &info
+	}
+	if a.state != StateDisconnected && !a.lastTelemetry.IsZero() {
+		lastTelemetry := a.lastTelemetry
+		status.LastTelemetry = &lastTelemetry
+	}
+	return status
+}
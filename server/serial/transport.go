@@ -0,0 +1,219 @@
+package serial
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+// Transport kinds understood by NewTransport
+const (
+	TransportSerial    = "serial"
+	TransportTCP       = "tcp"
+	TransportSimulator = "sim"
+)
+
+// Transport is a byte stream to a board, such as a local serial port or a
+// TCP socket exposed by a ser2net bridge or a Wi-Fi shield
+type Transport interface {
+	io.ReadWriteCloser
+	Open() error
+	Info() TransportInfo
+}
+
+// TransportInfo describes a transport for logging and the API
+type TransportInfo struct {
+	Kind     string `json:"kind"`
+	Address  string `json:"address"`
+	BaudRate int    `json:"baudRate,omitempty"`
+}
+
+// NewTransport creates an unopened transport of the given kind
+func NewTransport(kind, address string, baudRate int) (Transport, error) {
+	// The simulator's address is its scenario name and may be omitted
+	if kind == TransportSimulator {
+		return NewSimulator(address), nil
+	}
+
+	if address == "" {
+		return nil, fmt.Errorf("transport address is required")
+	}
+
+	switch kind {
+	case "", TransportSerial:
+		if baudRate == 0 {
+			baudRate = 9600
+		}
+		return NewSerialTransport(address, baudRate), nil
+	case TransportTCP:
+		return NewTCPTransport(address), nil
+	default:
+		return nil, fmt.Errorf("unknown transport kind: %s", kind)
+	}
+}
+
+// SerialTransport is a transport over a local serial port
+type SerialTransport struct {
+	name     string
+	baudRate int
+	port     *serial.Port
+	mutex    sync.Mutex
+}
+
+// NewSerialTransport creates a serial port transport
+func NewSerialTransport(name string, baudRate int) *SerialTransport {
+	return &SerialTransport{
+		name:     name,
+		baudRate: baudRate,
+	}
+}
+
+// Open opens the serial port
+func (s *SerialTransport) Open() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.port != nil {
+		return fmt.Errorf("port %s is already open", s.name)
+	}
+
+	config := &serial.Config{
+		Name:        s.name,
+		Baud:        s.baudRate,
+		ReadTimeout: time.Second * 5,
+	}
+
+	port, err := serial.OpenPort(config)
+	if err != nil {
+		return fmt.Errorf("failed to open port %s: %w", s.name, err)
+	}
+
+	s.port = port
+	return nil
+}
+
+// Close closes the serial port
+func (s *SerialTransport) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.port == nil {
+		return nil
+	}
+
+	err := s.port.Close()
+	s.port = nil
+	return err
+}
+
+// Read reads from the serial port
+func (s *SerialTransport) Read(p []byte) (int, error) {
+	port := s.current()
+	if port == nil {
+		return 0, io.EOF
+	}
+	return port.Read(p)
+}
+
+// Write writes to the serial port
+func (s *SerialTransport) Write(p []byte) (int, error) {
+	port := s.current()
+	if port == nil {
+		return 0, fmt.Errorf("port %s is not open", s.name)
+	}
+	return port.Write(p)
+}
+
+// Info returns the transport description
+func (s *SerialTransport) Info() TransportInfo {
+	return TransportInfo{Kind: TransportSerial, Address: s.name, BaudRate: s.baudRate}
+}
+
+// current returns the open port, or nil when closed
+func (s *SerialTransport) current() *serial.Port {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.port
+}
+
+// TCPTransport is a transport over a TCP socket
+type TCPTransport struct {
+	address     string
+	dialTimeout time.Duration
+	conn        net.Conn
+	mutex       sync.Mutex
+}
+
+// NewTCPTransport creates a TCP transport for a host:port address
+func NewTCPTransport(address string) *TCPTransport {
+	return &TCPTransport{
+		address:     address,
+		dialTimeout: 5 * time.Second,
+	}
+}
+
+// Open dials the remote address
+func (t *TCPTransport) Open() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.conn != nil {
+		return fmt.Errorf("connection to %s is already open", t.address)
+	}
+
+	conn, err := net.DialTimeout("tcp", t.address, t.dialTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to dial %s: %w", t.address, err)
+	}
+
+	t.conn = conn
+	return nil
+}
+
+// Close closes the socket
+func (t *TCPTransport) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.conn == nil {
+		return nil
+	}
+
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+// Read reads from the socket
+func (t *TCPTransport) Read(p []byte) (int, error) {
+	conn := t.current()
+	if conn == nil {
+		return 0, io.EOF
+	}
+	return conn.Read(p)
+}
+
+// Write writes to the socket
+func (t *TCPTransport) Write(p []byte) (int, error) {
+	conn := t.current()
+	if conn == nil {
+		return 0, fmt.Errorf("connection to %s is not open", t.address)
+	}
+	return conn.Write(p)
+}
+
+// Info returns the transport description
+func (t *TCPTransport) Info() TransportInfo {
+	return TransportInfo{Kind: TransportTCP, Address: t.address}
+}
+
+// current returns the open connection, or nil when closed
+func (t *TCPTransport) current() net.Conn {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.conn
+}
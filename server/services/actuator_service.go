@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/caphefalumi/smart-home/database"
+	"github.com/caphefalumi/smart-home/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ActuatorService handles the actuator audit trail
+type ActuatorService struct {
+	db         *database.Database
+	collection string
+}
+
+// NewActuatorService creates a new actuator service
+func NewActuatorService(db *database.Database) *ActuatorService {
+	return &ActuatorService{
+		db:         db,
+		collection: "actuatorevents",
+	}
+}
+
+// ActuatorHistoryFilter selects actuator events. Empty fields match everything.
+type ActuatorHistoryFilter struct {
+	DeviceID  string
+	Actuator  string
+	Origin    string
+	OriginID  string
+	StartDate *time.Time
+	EndDate   *time.Time
+}
+
+// SaveEvents saves multiple actuator events to MongoDB
+func (s *ActuatorService) SaveEvents(events []models.ActuatorEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	docs := make([]interface{}, len(events))
+	for i, event := range events {
+		docs[i] = event
+	}
+
+	_, err := coll.InsertMany(ctx, docs)
+	if err != nil {
+		return fmt.Errorf("failed to save actuator events: %w", err)
+	}
+
+	return nil
+}
+
+// GetHistory retrieves paginated actuator events, newest first
+func (s *ActuatorService) GetHistory(filter ActuatorHistoryFilter, limit, skip int) ([]models.ActuatorEvent, int64, error) {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	query := deviceFilter(bson.M{}, filter.DeviceID)
+	if filter.Actuator != "" {
+		query["actuator"] = filter.Actuator
+	}
+	if filter.Origin != "" {
+		query["origin.kind"] = filter.Origin
+	}
+	if filter.OriginID != "" {
+		query["origin.id"] = filter.OriginID
+	}
+	if filter.StartDate != nil || filter.EndDate != nil {
+		timeFilter := bson.M{}
+		if filter.StartDate != nil {
+			timeFilter["$gte"] = *filter.StartDate
+		}
+		if filter.EndDate != nil {
+			timeFilter["$lte"] = *filter.EndDate
+		}
+		query["timestamp"] = timeFilter
+	}
+
+	total, err := coll.Find(ctx, query).Count()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count actuator events: %w", err)
+	}
+
+	var events []models.ActuatorEvent
+	err = coll.Find(ctx, query).Sort("-timestamp").Limit(int64(limit)).Skip(int64(skip)).All(&events)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get actuator history: %w", err)
+	}
+
+	return events, total, nil
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+)
+
+// MaxBacktestRange is the longest stretch of history a backtest replays
+const MaxBacktestRange = 31 * 24 * time.Hour
+
+// maxBacktestTriggers bounds the triggers a backtest lists. Counts cover all
+// of them.
+const maxBacktestTriggers = 1000
+
+// ReadingSource yields the readings a device recorded between start and end,
+// oldest first. SensorService is the source of live backtests.
+type ReadingSource interface {
+	EachReading(deviceID string, start, end time.Time, fn func(*models.SensorData) error) error
+}
+
+// BacktestTrigger is a reading on which a replayed rule fired or cleared
+type BacktestTrigger struct {
+	Timestamp time.Time           `json:"timestamp"`
+	Cleared   bool                `json:"cleared,omitempty"`
+	Alert     string              `json:"alert"`
+	Mode      string              `json:"mode"`
+	Actions   []models.RuleAction `json:"actions"`
+}
+
+// BacktestResult is the outcome of replaying recorded readings through a rule
+type BacktestResult struct {
+	DeviceID  string            `json:"deviceId"`
+	Start     time.Time         `json:"start"`
+	End       time.Time         `json:"end"`
+	Readings  int               `json:"readings"`
+	Count     int               `json:"count"`  // times the rule fired
+	Clears    int               `json:"clears"` // times a latching rule cleared
+	Triggers  []BacktestTrigger `json:"triggers"`
+	Truncated bool              `json:"truncated"`
+	Warnings  []string          `json:"warnings,omitempty"`
+}
+
+// Backtest replays the readings a device recorded between start and end
+// through a rule, with the same cooldown, duration, hysteresis, window and
+// mode handling as live evaluation, and reports when it would have fired
+// and cleared. Nothing is sent to the device. Buttons and actuator states
+// are not recorded with readings, so buttons read as released and actuator
+// comparisons never hold. Callers bound the range to MaxBacktestRange.
+func (r *RuleService) Backtest(rule *models.Rule, deviceID string, start, end time.Time, source ReadingSource, modes *ModeTimeline) (*BacktestResult, error) {
+	result := &BacktestResult{
+		DeviceID: deviceID,
+		Start:    start,
+		End:      end,
+		Triggers: []BacktestTrigger{},
+		Warnings: backtestWarnings(rule),
+	}
+
+	compiled := compileRule(*rule)
+	key := ruleKey{rule: rule.ID, device: deviceID}
+	tracker := newRuleTracker(false)
+	signals := NewSignalHistory()
+
+	err := source.EachReading(deviceID, start, end, func(data *models.SensorData) error {
+		reading := &models.SensorReading{
+			Gas:       data.Gas,
+			Light:     data.Light,
+			Soil:      data.Soil,
+			Water:     data.Water,
+			Infrar:    data.Infrared,
+			Btn1:      1,
+			Btn2:      1,
+			Channels:  data.Channels,
+			Timestamp: data.Timestamp,
+		}
+		signals.Add(reading)
+		result.Readings++
+
+		mode := modes.At(reading.Timestamp)
+		input := RuleInput{Reading: reading, Signals: signals, Mode: mode}
+		inScope := r.inWindow(rule, reading.Timestamp) && models.InModes(rule.Modes, mode)
+
+		event, ok := tracker.evaluate(compiled, key, inScope, input)
+		if !ok {
+			return nil
+		}
+		if event.cleared {
+			result.Clears++
+		} else {
+			result.Count++
+		}
+
+		if len(result.Triggers) == maxBacktestTriggers {
+			result.Truncated = true
+			return nil
+		}
+		actions := event.actions
+		if actions == nil {
+			actions = []models.RuleAction{}
+		}
+		result.Triggers = append(result.Triggers, BacktestTrigger{
+			Timestamp: reading.Timestamp,
+			Cleared:   event.cleared,
+			Alert:     event.alert,
+			Mode:      mode,
+			Actions:   actions,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// backtestWarnings lists the comparisons of a rule that recorded history
+// cannot answer
+func backtestWarnings(rule *models.Rule) []string {
+	var warnings []string
+	seen := make(map[string]bool)
+	var walk func(c *models.Condition)
+	walk = func(c *models.Condition) {
+		for i := range c.And {
+			walk(&c.And[i])
+		}
+		for i := range c.Or {
+			walk(&c.Or[i])
+		}
+
+		var warning string
+		switch {
+		case c.Actuator != "":
+			warning = fmt.Sprintf("actuator states are not recorded, so %s never holds", c)
+		case c.Sensor == "btn1" || c.Sensor == "btn2":
+			warning = fmt.Sprintf("buttons are not recorded and read as released in %s", c)
+		}
+		if warning != "" && !seen[warning] {
+			seen[warning] = true
+			warnings = append(warnings, warning)
+		}
+	}
+
+	walk(rule.EffectiveCondition())
+	if rule.ClearCondition != nil {
+		walk(rule.ClearCondition)
+	}
+	return warnings
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var backtestStart = time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+
+// memoryReadings is a recorded history kept in memory, oldest first
+type memoryReadings []models.SensorData
+
+func (m memoryReadings) EachReading(deviceID string, start, end time.Time, fn func(*models.SensorData) error) error {
+	for i := range m {
+		data := &m[i]
+		if data.DeviceID != deviceID || data.Timestamp.Before(start) || data.Timestamp.After(end) {
+			continue
+		}
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gasReadings records one gas reading every step seconds, starting at
+// second from and taking the values in order
+func gasReadings(from, step int, values ...int) memoryReadings {
+	readings := make(memoryReadings, len(values))
+	for i, gas := range values {
+		readings[i] = models.SensorData{
+			DeviceID:  "kitchen",
+			Gas:       gas,
+			Timestamp: backtestStart.Add(time.Duration(from+i*step) * time.Second),
+		}
+	}
+	return readings
+}
+
+// repeat returns value n times
+func repeat(value, n int) []int {
+	values := make([]int, n)
+	for i := range values {
+		values[i] = value
+	}
+	return values
+}
+
+func TestBacktest(t *testing.T) {
+	awayAt10 := &ModeTimeline{
+		initial: models.ModeHome,
+		changes: []models.ModeChange{{Mode: models.ModeAway, Timestamp: backtestStart.Add(10 * time.Second)}},
+	}
+	latching := append(append(repeat(350, 10), 200), repeat(350, 9)...)
+	other := gasReadings(0, 1, repeat(350, 20)...)
+	for i := range other {
+		other[i].DeviceID = "garage"
+	}
+
+	tests := []struct {
+		name         string
+		rule         models.Rule
+		readings     memoryReadings
+		modes        *ModeTimeline
+		start, end   int // seconds after backtestStart
+		wantReadings int
+		wantCount    int
+		wantClears   int
+		wantAt       []int // seconds of the listed triggers
+		wantModes    []string
+	}{
+		{
+			name:         "cooldown",
+			rule:         models.Rule{Condition: gasAbove(300)},
+			readings:     gasReadings(0, 1, repeat(350, 20)...),
+			end:          60,
+			wantReadings: 20,
+			wantCount:    4,
+			wantAt:       []int{0, 6, 12, 18},
+		},
+		{
+			name:         "readings at the cooldown",
+			rule:         models.Rule{Condition: gasAbove(300)},
+			readings:     gasReadings(0, 5, repeat(350, 5)...),
+			end:          60,
+			wantReadings: 5,
+			wantCount:    3,
+			wantAt:       []int{0, 10, 20},
+		},
+		{
+			name:         "below threshold",
+			rule:         models.Rule{Condition: gasAbove(300)},
+			readings:     gasReadings(0, 1, 100, 200, 300, 250),
+			end:          60,
+			wantReadings: 4,
+			wantAt:       []int{},
+		},
+		{
+			name:         "range and device",
+			rule:         models.Rule{Condition: gasAbove(300)},
+			readings:     append(gasReadings(0, 1, repeat(350, 20)...), other...),
+			start:        5,
+			end:          14,
+			wantReadings: 10,
+			wantCount:    2,
+			wantAt:       []int{5, 11},
+		},
+		{
+			name:         "latching with release",
+			rule:         models.Rule{Condition: gasAbove(300), ForSeconds: 5},
+			readings:     gasReadings(0, 1, latching...),
+			end:          60,
+			wantReadings: 20,
+			wantCount:    2,
+			wantClears:   1,
+			wantAt:       []int{5, 10, 16},
+		},
+		{
+			name:         "house modes",
+			rule:         models.Rule{Condition: gasAbove(300), Modes: []string{models.ModeAway}},
+			readings:     gasReadings(0, 1, repeat(350, 20)...),
+			modes:        awayAt10,
+			end:          60,
+			wantReadings: 20,
+			wantCount:    2,
+			wantAt:       []int{10, 16},
+			wantModes:    []string{models.ModeAway, models.ModeAway},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modes := tt.modes
+			if modes == nil {
+				modes = FixedMode(models.ModeHome)
+			}
+			tt.rule.ID = primitive.NewObjectID()
+			tt.rule.Name = tt.name
+			start := backtestStart.Add(time.Duration(tt.start) * time.Second)
+			end := backtestStart.Add(time.Duration(tt.end) * time.Second)
+
+			result, err := NewRuleService(nil).Backtest(&tt.rule, "kitchen", start, end, tt.readings, modes)
+			if err != nil {
+				t.Fatalf("Backtest() failed: %v", err)
+			}
+
+			if result.Readings != tt.wantReadings || result.Count != tt.wantCount || result.Clears != tt.wantClears {
+				t.Errorf("readings, count, clears = %d, %d, %d, want %d, %d, %d",
+					result.Readings, result.Count, result.Clears, tt.wantReadings, tt.wantCount, tt.wantClears)
+			}
+			if result.Truncated {
+				t.Errorf("result is truncated")
+			}
+
+			at := make([]int, len(result.Triggers))
+			for i, trigger := range result.Triggers {
+				at[i] = int(trigger.Timestamp.Sub(backtestStart) / time.Second)
+				if tt.wantModes != nil && i < len(tt.wantModes) && trigger.Mode != tt.wantModes[i] {
+					t.Errorf("trigger %d mode = %q, want %q", i, trigger.Mode, tt.wantModes[i])
+				}
+			}
+			if !equalInts(at, tt.wantAt) {
+				t.Errorf("triggers at %v, want %v", at, tt.wantAt)
+			}
+		})
+	}
+}
+
+func TestBacktestTruncates(t *testing.T) {
+	rule := &models.Rule{ID: primitive.NewObjectID(), Name: "Gas", Condition: gasAbove(300)}
+	readings := gasReadings(0, 10, repeat(350, maxBacktestTriggers+5)...)
+	end := backtestStart.Add(24 * time.Hour)
+
+	result, err := NewRuleService(nil).Backtest(rule, "kitchen", backtestStart, end, readings, FixedMode(models.ModeHome))
+	if err != nil {
+		t.Fatalf("Backtest() failed: %v", err)
+	}
+	if result.Count != maxBacktestTriggers+5 || len(result.Triggers) != maxBacktestTriggers || !result.Truncated {
+		t.Errorf("count %d, %d triggers, truncated %v, want %d, %d, true",
+			result.Count, len(result.Triggers), result.Truncated, maxBacktestTriggers+5, maxBacktestTriggers)
+	}
+}
+
+// failingReadings fails after yielding its readings
+type failingReadings struct {
+	memoryReadings
+	err error
+}
+
+func (f failingReadings) EachReading(deviceID string, start, end time.Time, fn func(*models.SensorData) error) error {
+	if err := f.memoryReadings.EachReading(deviceID, start, end, fn); err != nil {
+		return err
+	}
+	return f.err
+}
+
+func TestBacktestSourceError(t *testing.T) {
+	rule := &models.Rule{ID: primitive.NewObjectID(), Condition: gasAbove(300)}
+	failure := errors.New("cursor closed")
+	source := failingReadings{memoryReadings: gasReadings(0, 1, 350), err: failure}
+
+	result, err := NewRuleService(nil).Backtest(rule, "kitchen", backtestStart, backtestStart.Add(time.Hour), source, FixedMode(models.ModeHome))
+	if !errors.Is(err, failure) || result != nil {
+		t.Errorf("Backtest() = %v, %v, want %v", result, err, failure)
+	}
+}
+
+func TestBacktestWarnings(t *testing.T) {
+	tests := []struct {
+		name string
+		rule models.Rule
+		want int
+	}{
+		{"sensors only", models.Rule{Condition: gasAbove(300)}, 0},
+		{"actuator", models.Rule{Condition: &models.Condition{Actuator: "fan", Operator: "==", Value: 1}}, 1},
+		{"button", models.Rule{Condition: &models.Condition{Sensor: "btn1", Operator: "==", Value: 0}}, 1},
+		{"repeated and nested", models.Rule{
+			Condition: &models.Condition{Or: []models.Condition{
+				{Sensor: "btn1", Operator: "==", Value: 0},
+				{And: []models.Condition{*gasAbove(300), {Sensor: "btn1", Operator: "==", Value: 0}}},
+			}},
+			ClearCondition: &models.Condition{Actuator: "fan", Operator: "==", Value: 0},
+		}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backtestWarnings(&tt.rule); len(got) != tt.want {
+				t.Errorf("backtestWarnings() = %q, want %d warning(s)", got, tt.want)
+			}
+		})
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
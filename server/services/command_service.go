@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/caphefalumi/smart-home/database"
+	"github.com/caphefalumi/smart-home/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CommandService persists the device command queue
+type CommandService struct {
+	db         *database.Database
+	collection string
+}
+
+// NewCommandService creates a new command service
+func NewCommandService(db *database.Database) *CommandService {
+	return &CommandService{
+		db:         db,
+		collection: "commands",
+	}
+}
+
+// CreateCommand stores a newly queued command
+func (s *CommandService) CreateCommand(command *models.Command) error {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	command.ID = primitive.NewObjectID()
+	command.CreatedAt = time.Now()
+	command.UpdatedAt = command.CreatedAt
+
+	_, err := coll.InsertOne(ctx, command)
+	if err != nil {
+		return fmt.Errorf("failed to create command: %w", err)
+	}
+
+	return nil
+}
+
+// MarkCommandSent moves a pending command to sent. It returns
+// qmgo.ErrNoSuchDocuments when the command is no longer pending, e.g. because it
+// was canceled.
+func (s *CommandService) MarkCommandSent(id primitive.ObjectID) error {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	filter := bson.M{"_id": id, "status": bson.M{"$in": []string{models.CommandPending, models.CommandSent}}}
+	update := bson.M{"$set": bson.M{
+		"status":    models.CommandSent,
+		"updatedAt": time.Now(),
+	}}
+
+	return coll.UpdateOne(ctx, filter, update)
+}
+
+// UpdateCommandStatus records a status change of a command
+func (s *CommandService) UpdateCommandStatus(id primitive.ObjectID, status, reply string, attempts int) error {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	update := bson.M{"$set": bson.M{
+		"status":    status,
+		"reply":     reply,
+		"attempts":  attempts,
+		"updatedAt": time.Now(),
+	}}
+
+	if err := coll.UpdateId(ctx, id, update); err != nil {
+		return fmt.Errorf("failed to update command: %w", err)
+	}
+
+	return nil
+}
+
+// GetCommands retrieves recent commands, optionally filtered by device and status
+func (s *CommandService) GetCommands(deviceID string, statuses []string, limit int) ([]models.Command, error) {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	filter := bson.M{}
+	if deviceID != "" {
+		filter["deviceId"] = deviceID
+	}
+	if len(statuses) > 0 {
+		filter["status"] = bson.M{"$in": statuses}
+	}
+
+	var commands []models.Command
+	err := coll.Find(ctx, filter).Sort("-createdAt").Limit(int64(limit)).All(&commands)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commands: %w", err)
+	}
+
+	return commands, nil
+}
+
+// GetCommand retrieves a command by ID
+func (s *CommandService) GetCommand(id string) (*models.Command, error) {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command ID: %w", err)
+	}
+
+	var command models.Command
+	if err := coll.Find(ctx, bson.M{"_id": objectID}).One(&command); err != nil {
+		return nil, err
+	}
+
+	return &command, nil
+}
+
+// RestoreCommands returns the commands of a device left pending or in flight,
+// oldest first, and puts them back to pending. Commands past their expiry are
+// marked expired instead.
+func (s *CommandService) RestoreCommands(deviceID string) ([]models.Command, error) {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+	now := time.Now()
+
+	unfinished := bson.M{
+		"deviceId": deviceID,
+		"status":   bson.M{"$in": []string{models.CommandPending, models.CommandSent}},
+	}
+
+	expired := bson.M{"expiresAt": bson.M{"$lte": now}}
+	for key, value := range unfinished {
+		expired[key] = value
+	}
+	_, err := coll.UpdateAll(ctx, expired, bson.M{"$set": bson.M{
+		"status":    models.CommandExpired,
+		"updatedAt": now,
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire commands: %w", err)
+	}
+
+	_, err = coll.UpdateAll(ctx, unfinished, bson.M{"$set": bson.M{
+		"status":    models.CommandPending,
+		"updatedAt": now,
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore commands: %w", err)
+	}
+
+	var commands []models.Command
+	if err := coll.Find(ctx, unfinished).Sort("createdAt").All(&commands); err != nil {
+		return nil, fmt.Errorf("failed to get unfinished commands: %w", err)
+	}
+
+	return commands, nil
+}
+
+// CancelCommand marks a pending command canceled. It returns
+// qmgo.ErrNoSuchDocuments when no pending command has the ID.
+func (s *CommandService) CancelCommand(id primitive.ObjectID) error {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	filter := bson.M{"_id": id, "status": models.CommandPending}
+	update := bson.M{"$set": bson.M{
+		"status":    models.CommandCanceled,
+		"updatedAt": time.Now(),
+	}}
+
+	return coll.UpdateOne(ctx, filter, update)
+}
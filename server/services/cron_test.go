@@ -0,0 +1,139 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+)
+
+// cronBase is a Wednesday
+var cronBase = time.Date(2026, 3, 4, 10, 17, 0, 0, time.UTC)
+
+func cronTime(month time.Month, day, hour, minute int) time.Time {
+	return time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"step", "*/15 * * * *", cronBase, cronTime(3, 4, 10, 30)},
+		{"strictly after", "17 10 * * *", cronBase, cronTime(3, 5, 10, 17)},
+		{"weekday range", "30 18 * * mon-fri", cronBase, cronTime(3, 4, 18, 30)},
+		{"weekday range over weekend", "30 18 * * mon-fri", cronTime(3, 6, 19, 0), cronTime(3, 9, 18, 30)},
+		{"range with step", "0 8-10/2 * * *", cronBase, cronTime(3, 5, 8, 0)},
+		{"month names", "0 0 1 jan,jul *", cronBase, cronTime(7, 1, 0, 0)},
+		{"day of month", "0 9 1 * *", cronBase, cronTime(4, 1, 9, 0)},
+		{"sunday as 0", "0 0 * * 0", cronBase, cronTime(3, 8, 0, 0)},
+		{"sunday as 7", "0 0 * * 7", cronBase, cronTime(3, 8, 0, 0)},
+		{"day names are case insensitive", "0 0 * * SUN", cronBase, cronTime(3, 8, 0, 0)},
+		{"daily macro", "@daily", cronBase, cronTime(3, 5, 0, 0)},
+		{"hourly macro", "@hourly", cronBase, cronTime(3, 4, 11, 0)},
+		{"day of month or weekday, weekday first", "0 12 10 * fri", cronBase, cronTime(3, 6, 12, 0)},
+		{"day of month or weekday, day first", "0 12 10 * fri", cronTime(3, 7, 0, 0), cronTime(3, 10, 12, 0)},
+		{"restricted weekday with any day", "0 12 * * fri", cronTime(3, 7, 0, 0), cronTime(3, 13, 12, 0)},
+		{"leap day", "0 0 29 2 *", cronBase, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"never", "0 0 30 2 *", cronBase, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cron, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q) failed: %v", tt.expr, err)
+			}
+			if got := cron.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{"empty", ""},
+		{"too few fields", "* * * *"},
+		{"too many fields", "* * * * * *"},
+		{"minute out of range", "60 * * * *"},
+		{"hour out of range", "0 24 * * *"},
+		{"day of month zero", "0 0 0 * *"},
+		{"month out of range", "0 0 1 13 *"},
+		{"weekday out of range", "0 0 * * 8"},
+		{"zero step", "*/0 * * * *"},
+		{"reversed range", "5-1 * * * *"},
+		{"not a number", "foo * * * *"},
+		{"unknown day name", "0 0 * * funday"},
+		{"unknown macro", "@fortnightly"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCron(tt.expr); err == nil {
+				t.Errorf("ParseCron(%q) succeeded, want an error", tt.expr)
+			}
+		})
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	past := cronBase.Add(-time.Hour)
+	future := cronBase.Add(time.Hour)
+	next := cronTime(3, 4, 10, 30)
+
+	tests := []struct {
+		name     string
+		schedule models.Schedule
+		want     *time.Time
+	}{
+		{"cron", models.Schedule{Cron: "*/15 * * * *"}, &next},
+		{"invalid cron", models.Schedule{Cron: "* * *"}, nil},
+		{"cron that never runs", models.Schedule{Cron: "0 0 30 2 *"}, nil},
+		{"one-off in the future", models.Schedule{At: &future}, &future},
+		{"one-off in the past", models.Schedule{At: &past}, nil},
+		{"one-off now", models.Schedule{At: &cronBase}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NextRun(&tt.schedule, cronBase)
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil || !got.Equal(*tt.want):
+				t.Errorf("NextRun() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsMissed(t *testing.T) {
+	due := cronBase
+
+	tests := []struct {
+		name   string
+		policy string
+		late   time.Duration
+		want   bool
+	}{
+		{"on time", models.MissedSkip, 0, false},
+		{"within grace", models.MissedSkip, MissedGrace, false},
+		{"late, skipped", models.MissedSkip, MissedGrace + time.Second, true},
+		{"late, run anyway", models.MissedRun, time.Hour, false},
+		{"late, no policy", "", time.Hour, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule := &models.Schedule{MissedRun: tt.policy}
+			if got := IsMissed(schedule, due, due.Add(tt.late)); got != tt.want {
+				t.Errorf("IsMissed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
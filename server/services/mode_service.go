@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/caphefalumi/smart-home/database"
+	"github.com/caphefalumi/smart-home/models"
+	"github.com/qiniu/qmgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ModeService keeps the house mode and the log of its changes. The current
+// mode is the one of the latest change, cached in memory.
+type ModeService struct {
+	db         *database.Database
+	collection string
+	mode       string
+	since      time.Time
+	mutex      sync.RWMutex // guards mode and since, never held across database calls
+	changes    sync.Mutex   // orders mode changes
+}
+
+// NewModeService creates a new mode service, starting in the home mode until
+// Load is called
+func NewModeService(db *database.Database) *ModeService {
+	return &ModeService{
+		db:         db,
+		collection: "modechanges",
+		mode:       models.ModeHome,
+	}
+}
+
+// Load restores the mode of the latest logged change
+func (s *ModeService) Load() error {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	var change models.ModeChange
+	if err := coll.Find(ctx, bson.M{}).Sort("-timestamp").One(&change); err != nil {
+		if err == qmgo.ErrNoSuchDocuments {
+			return nil
+		}
+		return fmt.Errorf("failed to load house mode: %w", err)
+	}
+
+	s.mutex.Lock()
+	s.mode = change.Mode
+	s.since = change.Timestamp
+	s.mutex.Unlock()
+	return nil
+}
+
+// GetMode returns the current house mode
+func (s *ModeService) GetMode() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.mode
+}
+
+// GetModeSince returns the current house mode and when it was set. The time
+// is zero when the mode was never changed.
+func (s *ModeService) GetModeSince() (string, time.Time) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.mode, s.since
+}
+
+// SetMode switches the house mode and logs the change. It returns nil when
+// the house is already in that mode. Readers of the mode are not blocked
+// while the change is written.
+func (s *ModeService) SetMode(mode string, origin models.Origin) (*models.ModeChange, error) {
+	if err := models.ValidateMode(mode); err != nil {
+		return nil, err
+	}
+
+	s.changes.Lock()
+	defer s.changes.Unlock()
+
+	previous := s.GetMode()
+	if mode == previous {
+		return nil, nil
+	}
+
+	change := &models.ModeChange{
+		ID:        primitive.NewObjectID(),
+		Mode:      mode,
+		Previous:  previous,
+		Origin:    origin,
+		Timestamp: time.Now(),
+	}
+
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+	if _, err := coll.InsertOne(ctx, change); err != nil {
+		return nil, fmt.Errorf("failed to log mode change: %w", err)
+	}
+
+	s.mutex.Lock()
+	s.mode = mode
+	s.since = change.Timestamp
+	s.mutex.Unlock()
+
+	log.Printf("House mode changed from %s to %s by %s %s", change.Previous, mode, origin.Kind, origin.ID)
+	return change, nil
+}
+
+// GetHistory retrieves the latest mode changes, newest first
+func (s *ModeService) GetHistory(limit int) ([]models.ModeChange, error) {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	var changes []models.ModeChange
+	err := coll.Find(ctx, bson.M{}).Sort("-timestamp").Limit(int64(limit)).All(&changes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mode history: %w", err)
+	}
+
+	return changes, nil
+}
+
+// ModeTimeline is the house mode over a time range
+type ModeTimeline struct {
+	initial string
+	changes []models.ModeChange // oldest first
+}
+
+// FixedMode returns a timeline that stays in one mode
+func FixedMode(mode string) *ModeTimeline {
+	return &ModeTimeline{initial: mode}
+}
+
+// At returns the mode in effect at ts
+func (t *ModeTimeline) At(ts time.Time) string {
+	i := sort.Search(len(t.changes), func(i int) bool { return t.changes[i].Timestamp.After(ts) })
+	if i == 0 {
+		return t.initial
+	}
+	return t.changes[i-1].Mode
+}
+
+// GetTimeline rebuilds the house mode between start and end from the logged
+// changes. Before the first change the house was at home.
+func (s *ModeService) GetTimeline(start, end time.Time) (*ModeTimeline, error) {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	timeline := &ModeTimeline{initial: models.ModeHome}
+
+	var before models.ModeChange
+	err := coll.Find(ctx, bson.M{"timestamp": bson.M{"$lt": start}}).Sort("-timestamp").One(&before)
+	switch {
+	case err == nil:
+		timeline.initial = before.Mode
+	case err != qmgo.ErrNoSuchDocuments:
+		return nil, fmt.Errorf("failed to get mode history: %w", err)
+	}
+
+	query := bson.M{"timestamp": bson.M{"$gte": start, "$lte": end}}
+	if err := coll.Find(ctx, query).Sort("timestamp").All(&timeline.changes); err != nil {
+		return nil, fmt.Errorf("failed to get mode history: %w", err)
+	}
+
+	return timeline, nil
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/caphefalumi/smart-home/database"
+	"github.com/caphefalumi/smart-home/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// NotificationService stores the messages of notify actions
+type NotificationService struct {
+	db         *database.Database
+	collection string
+}
+
+// NewNotificationService creates a new notification service
+func NewNotificationService(db *database.Database) *NotificationService {
+	return &NotificationService{
+		db:         db,
+		collection: "notifications",
+	}
+}
+
+// SaveNotification saves a notification to MongoDB
+func (s *NotificationService) SaveNotification(notification *models.Notification) error {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	_, err := coll.InsertOne(ctx, notification)
+	if err != nil {
+		return fmt.Errorf("failed to save notification: %w", err)
+	}
+
+	return nil
+}
+
+// GetNotifications retrieves the latest notifications, optionally scoped to
+// a device
+func (s *NotificationService) GetNotifications(deviceID string, limit int) ([]models.Notification, error) {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	query := bson.M{}
+	if deviceID != "" {
+		query["deviceId"] = deviceID
+	}
+
+	var notifications []models.Notification
+	err := coll.Find(ctx, query).Sort("-timestamp").Limit(int64(limit)).All(&notifications)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notifications: %w", err)
+	}
+
+	return notifications, nil
+}
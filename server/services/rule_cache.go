@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// rulesRefresh is how often the rule cache is reloaded when the database
+// offers no change stream
+const rulesRefresh = time.Minute
+
+// compiledRule is a rule prepared for evaluation, with its effective
+// condition and actions resolved once instead of on every reading
+type compiledRule struct {
+	rule      models.Rule
+	id        string
+	condition *models.Condition
+	actions   []models.RuleAction
+	latches   bool
+}
+
+// ruleKey identifies the evaluation state of a rule on one device
+type ruleKey struct {
+	rule   primitive.ObjectID
+	device string
+}
+
+// compileRule prepares a rule for evaluation
+func compileRule(rule models.Rule) *compiledRule {
+	return &compiledRule{
+		rule:      rule,
+		id:        rule.ID.Hex(),
+		condition: rule.EffectiveCondition(),
+		actions:   rule.EffectiveActions(),
+		latches:   rule.Latches(),
+	}
+}
+
+// LoadRules replaces the cached rules with the stored ones
+func (r *RuleService) LoadRules() error {
+	rules, err := r.GetAllRules()
+	if err != nil {
+		return err
+	}
+
+	compiled := make([]*compiledRule, len(rules))
+	known := make(map[primitive.ObjectID]bool, len(rules))
+	for i := range rules {
+		compiled[i] = compileRule(rules[i])
+		known[rules[i].ID] = true
+	}
+
+	r.cacheMutex.Lock()
+	r.rules = compiled
+	r.cacheMutex.Unlock()
+
+	r.mutex.Lock()
+	r.tracker.forget(func(id primitive.ObjectID) bool { return known[id] })
+	r.mutex.Unlock()
+
+	return nil
+}
+
+// cachedRules returns the cached rules, newest first. The slice is never
+// modified, so it can be used without holding a lock.
+func (r *RuleService) cachedRules() []*compiledRule {
+	r.cacheMutex.RLock()
+	defer r.cacheMutex.RUnlock()
+	return r.rules
+}
+
+// cacheRule adds a new rule to the cache or replaces a changed one
+func (r *RuleService) cacheRule(rule models.Rule) {
+	compiled := compileRule(rule)
+
+	r.cacheMutex.Lock()
+	defer r.cacheMutex.Unlock()
+
+	rules := make([]*compiledRule, 0, len(r.rules)+1)
+	replaced := false
+	for _, cached := range r.rules {
+		if cached.rule.ID == rule.ID {
+			cached = compiled
+			replaced = true
+		}
+		rules = append(rules, cached)
+	}
+	if !replaced {
+		rules = append([]*compiledRule{compiled}, rules...)
+	}
+	r.rules = rules
+}
+
+// uncacheRule removes a deleted rule from the cache and forgets its state
+func (r *RuleService) uncacheRule(id primitive.ObjectID) {
+	r.cacheMutex.Lock()
+	rules := make([]*compiledRule, 0, len(r.rules))
+	for _, cached := range r.rules {
+		if cached.rule.ID != id {
+			rules = append(rules, cached)
+		}
+	}
+	r.rules = rules
+	r.cacheMutex.Unlock()
+
+	r.mutex.Lock()
+	r.tracker.forget(func(rule primitive.ObjectID) bool { return rule != id })
+	r.mutex.Unlock()
+}
+
+// WatchRules keeps the rule cache in sync with changes made outside this
+// service, e.g. from the mongo shell, until ctx is done. It follows a change
+// stream when the database supports one (replica sets only) and otherwise
+// reloads the rules periodically.
+func (r *RuleService) WatchRules(ctx context.Context) {
+	coll := r.db.GetCollection(r.collection)
+
+	for {
+		stream, err := coll.Watch(ctx, mongo.Pipeline{})
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Rule change stream unavailable, reloading rules every %s: %v", rulesRefresh, err)
+				r.pollRules(ctx)
+			}
+			return
+		}
+
+		err = r.followChanges(ctx, stream)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Rule change stream failed, reopening in %s: %v", rulesRefresh, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(rulesRefresh):
+		}
+	}
+}
+
+// followChanges reloads the rules on every change reported by a stream
+// until ctx is done or the stream fails
+func (r *RuleService) followChanges(ctx context.Context, stream *mongo.ChangeStream) error {
+	defer stream.Close(context.Background())
+
+	// Changes made before the stream opened would otherwise be missed
+	if err := r.LoadRules(); err != nil {
+		log.Printf("Error reloading rules: %v", err)
+	}
+
+	for stream.Next(ctx) {
+		if err := r.LoadRules(); err != nil {
+			log.Printf("Error reloading rules: %v", err)
+		}
+	}
+	return stream.Err()
+}
+
+// pollRules reloads the rules every rulesRefresh until ctx is done
+func (r *RuleService) pollRules(ctx context.Context) {
+	ticker := time.NewTicker(rulesRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.LoadRules(); err != nil {
+				log.Printf("Error reloading rules: %v", err)
+			}
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/caphefalumi/smart-home/database"
@@ -13,19 +15,25 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// RuleService handles rule operations
+// RuleService handles rule operations. Rules are evaluated from an in-memory
+// cache, loaded by LoadRules and kept current by the service's own writes
+// and by WatchRules.
 type RuleService struct {
-	db            *database.Database
-	collection    string
-	lastTriggered map[string]time.Time // map of rule ID to last triggered time
+	db         *database.Database
+	collection string
+	rules      []*compiledRule // cached rules, newest first
+	cacheMutex sync.RWMutex    // guards rules
+	tracker    *ruleTracker    // cooldown and latching state of live evaluation
+	location   *geoLocation    // where sunrise and sunset are computed for, if configured
+	mutex      sync.Mutex
 }
 
 // NewRuleService creates a new rule service
 func NewRuleService(db *database.Database) *RuleService {
 	return &RuleService{
-		db:            db,
-		collection:    "rules",
-		lastTriggered: make(map[string]time.Time),
+		db:         db,
+		collection: "rules",
+		tracker:    newRuleTracker(true),
 	}
 }
 
@@ -43,11 +51,30 @@ func (r *RuleService) GetAllRules() ([]models.Rule, error) {
 	return rules, nil
 }
 
+// GetRule retrieves a rule by ID
+func (r *RuleService) GetRule(id string) (*models.Rule, error) {
+	ctx := context.Background()
+	coll := r.db.GetCollection(r.collection)
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule ID: %w", err)
+	}
+
+	var rule models.Rule
+	if err := coll.Find(ctx, bson.M{"_id": objectID}).One(&rule); err != nil {
+		return nil, err
+	}
+
+	return &rule, nil
+}
+
 // CreateRule creates a new rule
 func (r *RuleService) CreateRule(rule *models.Rule) error {
 	ctx := context.Background()
 	coll := r.db.GetCollection(r.collection)
 
+	rule.ID = primitive.NewObjectID()
 	rule.CreatedAt = time.Now()
 	rule.UpdatedAt = time.Now()
 
@@ -56,6 +83,7 @@ func (r *RuleService) CreateRule(rule *models.Rule) error {
 		return fmt.Errorf("failed to create rule: %w", err)
 	}
 
+	r.cacheRule(*rule)
 	return nil
 }
 
@@ -84,6 +112,7 @@ func (r *RuleService) UpdateRule(id string, updates map[string]interface{}) (*mo
 		return nil, fmt.Errorf("failed to update rule: %w", err)
 	}
 
+	r.cacheRule(rule)
 	return &rule, nil
 }
 
@@ -102,75 +131,138 @@ func (r *RuleService) DeleteRule(id string) error {
 		return fmt.Errorf("failed to delete rule: %w", err)
 	}
 
+	r.uncacheRule(objectID)
 	return nil
 }
 
-// EvaluateRules evaluates all active rules against sensor data
-func (r *RuleService) EvaluateRules(sensorData *models.SensorReading) ([]string, []string) {
-	rules, err := r.GetAllRules()
-	if err != nil {
-		log.Printf("Error getting rules for evaluation: %v", err)
-		return nil, nil
-	}
+// RuleInput is what the rules of a device are evaluated against
+type RuleInput struct {
+	Reading   *models.SensorReading  // the latest sensor reading
+	Actuators *models.ActuatorStates // reported actuator states, if known
+	Signals   *SignalHistory         // recent readings for statistics, if kept
+	Mode      string                 // the current house mode
+}
+
+// EvaluateRules evaluates all active rules against the latest reading and
+// state of a device. Rules without a device ID apply to every device, and
+// rules outside their active windows or house modes are skipped. Rules come
+// from the cache, so evaluation never waits for the database.
+func (r *RuleService) EvaluateRules(deviceID string, input RuleInput) ([]string, []models.TriggeredAction) {
+	rules := r.cachedRules()
 
-	var triggeredActions []string
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var triggeredActions []models.TriggeredAction
 	var alerts []string
 
-	for _, rule := range rules {
+	for _, compiled := range rules {
+		rule := &compiled.rule
+		key := ruleKey{rule: rule.ID, device: deviceID}
 		if !rule.Enabled {
+			r.tracker.reset(key)
+			continue
+		}
+		if rule.DeviceID != "" && rule.DeviceID != deviceID {
 			continue
 		}
 
-		var sensorValue int
-		switch rule.Sensor {
-		case "gas":
-			sensorValue = sensorData.Gas
-		case "light":
-			sensorValue = sensorData.Light
-		case "soil":
-			sensorValue = sensorData.Soil
-		case "water":
-			sensorValue = sensorData.Water
-		case "infrar":
-			sensorValue = sensorData.Infrar
-		default:
+		inScope := r.inWindow(rule, input.Reading.Timestamp) && models.InModes(rule.Modes, input.Mode)
+		event, ok := r.tracker.evaluate(compiled, key, inScope, input)
+		if !ok {
 			continue
 		}
+		alerts = append(alerts, event.alert)
+		if len(event.actions) > 0 {
+			triggeredActions = append(triggeredActions, models.TriggeredAction{RuleID: compiled.id, Actions: event.actions})
+		}
+	}
 
-		triggered := false
-		switch rule.Operator {
-		case ">":
-			triggered = sensorValue > rule.Threshold
-		case "<":
-			triggered = sensorValue < rule.Threshold
-		case ">=":
-			triggered = sensorValue >= rule.Threshold
-		case "<=":
-			triggered = sensorValue <= rule.Threshold
-		case "==":
-			triggered = sensorValue == rule.Threshold
+	return alerts, triggeredActions
+}
+
+// conditionValue looks up the value or statistic a comparison refers to
+func conditionValue(c *models.Condition, input RuleInput) (float64, bool) {
+	switch {
+	case c.Actuator != "":
+		if input.Actuators == nil {
+			return 0, false
 		}
+		return input.Actuators.Value(c.Actuator)
+	case c.Stat != "":
+		if input.Signals == nil {
+			return 0, false
+		}
+		return input.Signals.Stat(c.Sensor, c.Stat, time.Duration(c.Window)*time.Second)
+	}
+	return input.Reading.Value(c.Sensor)
+}
 
-		// Cooldown logic: only trigger if last trigger was more than 5 seconds ago
-		if triggered {
-			ruleID := rule.ID.Hex()
-			now := time.Now()
-			last, ok := r.lastTriggered[ruleID]
-			if !ok || now.Sub(last) > 5*time.Second {
-				triggeredActions = append(triggeredActions, rule.Action)
-				alerts = append(alerts, fmt.Sprintf("%s: %s %s %d (current: %d)",
-					rule.Name, rule.Sensor, rule.Operator, rule.Threshold, sensorValue))
-
-				log.Printf("Rule triggered: %s - %s %d %s %d",
-					rule.Name, rule.Sensor, sensorValue, rule.Operator, rule.Threshold)
-				r.lastTriggered[ruleID] = now
-			} else {
-				log.Printf("Rule %s cooldown active, not triggered", rule.Name)
+// evaluateCondition evaluates a condition tree. Comparisons on values the
+// reading does not carry are false.
+func evaluateCondition(c *models.Condition, input RuleInput) bool {
+	switch {
+	case c.And != nil:
+		for i := range c.And {
+			if !evaluateCondition(&c.And[i], input) {
+				return false
 			}
 		}
+		return len(c.And) > 0
+	case c.Or != nil:
+		for i := range c.Or {
+			if evaluateCondition(&c.Or[i], input) {
+				return true
+			}
+		}
+		return false
 	}
 
-	return alerts, triggeredActions
+	value, ok := conditionValue(c, input)
+	if !ok {
+		return false
+	}
+
+	switch c.Operator {
+	case ">":
+		return value > c.Value
+	case "<":
+		return value < c.Value
+	case ">=":
+		return value >= c.Value
+	case "<=":
+		return value <= c.Value
+	case "==":
+		return value == c.Value
+	case "!=":
+		return value != c.Value
+	}
+	return false
+}
+
+// describeCondition renders a condition with the current value of each
+// comparison, e.g. "gas > 700 (current: 812)"
+func describeCondition(c *models.Condition, input RuleInput) string {
+	join := func(children []models.Condition, op string) string {
+		parts := make([]string, len(children))
+		for i := range children {
+			parts[i] = describeCondition(&children[i], input)
+		}
+		return "(" + strings.Join(parts, " "+op+" ") + ")"
+	}
+
+	switch {
+	case c.And != nil:
+		return join(c.And, "AND")
+	case c.Or != nil:
+		return join(c.Or, "OR")
+	}
+
+	value, ok := conditionValue(c, input)
+	if !ok {
+		return c.String() + " (current: n/a)"
+	}
+	return fmt.Sprintf("%s (current: %g)", c.String(), value)
 }
 
 // CountRules returns the total number of rules
@@ -210,13 +302,16 @@ func InitializeDefaultRules(db *database.Database) error {
 			Description: "Trigger buzzer when gas level exceeds danger threshold",
 		},
 		{
-			Name:        "Rain Detection - Close Window",
-			Sensor:      "water",
-			Operator:    ">",
-			Threshold:   800,
-			Action:      "window_close",
+			Name:      "Rain Detection - Close Window",
+			Sensor:    "water",
+			Operator:  ">",
+			Threshold: 800,
+			Actions: []models.RuleAction{
+				{Type: models.ActionCommand, Command: "window_close"},
+				{Type: models.ActionCommand, Command: "fan_off", OnError: models.OnErrorContinue},
+			},
 			Enabled:     true,
-			Description: "Automatically close window when rain is detected",
+			Description: "Automatically close window and stop the fan when rain is detected",
 		},
 		{
 			Name:        "Low Soil Moisture Alert",
@@ -228,13 +323,17 @@ func InitializeDefaultRules(db *database.Database) error {
 			Description: "Alert when soil moisture is too low",
 		},
 		{
-			Name:        "Auto Light - Low Light Detection",
-			Sensor:      "light",
-			Operator:    "<",
-			Threshold:   300,
-			Action:      "white_light_on",
-			Enabled:     true,
-			Description: "Automatically turn on LED when light level is low",
+			Name:           "Auto Light - Low Light Detection",
+			Sensor:         "light",
+			Operator:       "<",
+			Threshold:      300,
+			ForSeconds:     10,
+			ClearCondition: &models.Condition{Sensor: "light", Operator: ">", Value: 400},
+			Windows:        []models.ActiveWindow{{From: "17:00", To: "23:00"}},
+			Action:         "white_light_on",
+			ClearActions:   []models.RuleAction{{Type: models.ActionCommand, Command: "white_light_off"}},
+			Enabled:        true,
+			Description:    "In the evening, turn on LED after 10 seconds of low light and off again once it is bright",
 		},
 	}
 
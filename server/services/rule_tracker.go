@@ -0,0 +1,146 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ruleCooldown is how long a plain rule waits before it fires again
+const ruleCooldown = 5 * time.Second
+
+// ruleState tracks a latching rule on one device
+type ruleState struct {
+	active  bool      // fired and not cleared yet
+	since   time.Time // when the condition started holding
+	samples int       // consecutive readings the condition held for
+}
+
+// ruleTracker holds the cooldown and latching state of rules and advances
+// it on each reading. Times are taken from the readings, so recorded history
+// can be replayed with the same results as live evaluation.
+type ruleTracker struct {
+	lastTriggered map[ruleKey]time.Time  // last triggered time per rule and device
+	states        map[ruleKey]*ruleState // latching state per rule and device
+	verbose       bool                   // log triggers, clears and cooldowns
+}
+
+// ruleEvent is a rule firing or clearing on a reading
+type ruleEvent struct {
+	alert   string
+	actions []models.RuleAction
+	cleared bool
+}
+
+// newRuleTracker creates an empty rule tracker
+func newRuleTracker(verbose bool) *ruleTracker {
+	return &ruleTracker{
+		lastTriggered: make(map[ruleKey]time.Time),
+		states:        make(map[ruleKey]*ruleState),
+		verbose:       verbose,
+	}
+}
+
+// evaluate advances a rule on a reading and reports whether it fired or
+// cleared. inScope tells whether the rule is inside its active windows and
+// house modes.
+func (t *ruleTracker) evaluate(compiled *compiledRule, key ruleKey, inScope bool, input RuleInput) (ruleEvent, bool) {
+	if compiled.latches {
+		return t.evaluateLatching(compiled, key, inScope, input)
+	}
+	if !inScope || !evaluateCondition(compiled.condition, input) {
+		return ruleEvent{}, false
+	}
+
+	rule := &compiled.rule
+	now := input.Reading.Timestamp
+	if last, ok := t.lastTriggered[key]; ok && now.Sub(last) <= ruleCooldown {
+		if t.verbose {
+			log.Printf("Rule %s cooldown active, not triggered", rule.Name)
+		}
+		return ruleEvent{}, false
+	}
+
+	t.lastTriggered[key] = now
+	if t.verbose {
+		log.Printf("Rule triggered: %s - %s", rule.Name, compiled.condition)
+	}
+	return ruleEvent{
+		alert:   fmt.Sprintf("%s: %s", rule.Name, describeCondition(compiled.condition, input)),
+		actions: compiled.actions,
+	}, true
+}
+
+// evaluateLatching advances the state of a latching rule. Outside its active
+// windows and house modes a rule does not fire, but an active rule can still
+// clear.
+func (t *ruleTracker) evaluateLatching(compiled *compiledRule, key ruleKey, inScope bool, input RuleInput) (ruleEvent, bool) {
+	rule, condition := &compiled.rule, compiled.condition
+	state, ok := t.states[key]
+	if !ok {
+		state = &ruleState{}
+		t.states[key] = state
+	}
+
+	if state.active {
+		cleared := !evaluateCondition(condition, input)
+		if rule.ClearCondition != nil {
+			cleared = evaluateCondition(rule.ClearCondition, input)
+		}
+		if !cleared {
+			return ruleEvent{}, false
+		}
+
+		delete(t.states, key)
+		if t.verbose {
+			log.Printf("Rule cleared: %s", rule.Name)
+		}
+		return ruleEvent{alert: fmt.Sprintf("%s: cleared", rule.Name), actions: rule.ClearActions, cleared: true}, true
+	}
+
+	if !inScope || !evaluateCondition(condition, input) {
+		delete(t.states, key)
+		return ruleEvent{}, false
+	}
+
+	now := input.Reading.Timestamp
+	if state.samples == 0 {
+		state.since = now
+	}
+	state.samples++
+	if state.samples < rule.ForSamples || now.Sub(state.since) < time.Duration(rule.ForSeconds)*time.Second {
+		return ruleEvent{}, false
+	}
+
+	state.active = true
+	if t.verbose {
+		log.Printf("Rule triggered: %s - %s held for %d reading(s) over %s",
+			rule.Name, condition, state.samples, now.Sub(state.since).Round(time.Second))
+	}
+	return ruleEvent{
+		alert:   fmt.Sprintf("%s: %s", rule.Name, describeCondition(condition, input)),
+		actions: compiled.actions,
+	}, true
+}
+
+// reset forgets the state of a rule on one device
+func (t *ruleTracker) reset(key ruleKey) {
+	delete(t.states, key)
+}
+
+// forget drops the state of every rule that keep rejects
+func (t *ruleTracker) forget(keep func(primitive.ObjectID) bool) {
+	for key := range t.states {
+		if !keep(key.rule) {
+			delete(t.states, key)
+		}
+	}
+	for key := range t.lastTriggered {
+		if !keep(key.rule) {
+			delete(t.lastTriggered, key)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var trackerStart = time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+
+// trackerStep is a reading fed to the tracker and the event it should cause:
+// "fire", "clear" or nothing
+type trackerStep struct {
+	at    int // seconds after trackerStart
+	gas   int
+	out   bool // outside the rule's windows or modes
+	event string
+}
+
+func gasAbove(value float64) *models.Condition {
+	return &models.Condition{Sensor: "gas", Operator: ">", Value: value}
+}
+
+func gasBelow(value float64) *models.Condition {
+	return &models.Condition{Sensor: "gas", Operator: "<", Value: value}
+}
+
+// runTracker feeds the steps to a tracker and checks each event
+func runTracker(t *testing.T, tracker *ruleTracker, compiled *compiledRule, key ruleKey, steps []trackerStep) {
+	t.Helper()
+	for i, step := range steps {
+		reading := &models.SensorReading{Gas: step.gas, Timestamp: trackerStart.Add(time.Duration(step.at) * time.Second)}
+		event, ok := tracker.evaluate(compiled, key, !step.out, RuleInput{Reading: reading})
+
+		got := ""
+		switch {
+		case ok && event.cleared:
+			got = "clear"
+		case ok:
+			got = "fire"
+		}
+		if got != step.event {
+			t.Errorf("step %d (t=%ds, gas=%d, out=%v): got %q, want %q", i, step.at, step.gas, step.out, got, step.event)
+		}
+	}
+}
+
+func TestRuleTrackerTransitions(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  models.Rule
+		steps []trackerStep
+	}{
+		{
+			name: "cooldown without latching",
+			rule: models.Rule{Condition: gasAbove(300)},
+			steps: []trackerStep{
+				{at: 0, gas: 350, event: "fire"},
+				{at: 1, gas: 350},
+				{at: 5, gas: 350},
+				{at: 6, gas: 350, event: "fire"},
+				{at: 7, gas: 200},
+				{at: 12, gas: 350, event: "fire"},
+				{at: 20, gas: 350, out: true},
+			},
+		},
+		{
+			name: "held for seconds",
+			rule: models.Rule{Condition: gasAbove(300), ForSeconds: 5},
+			steps: []trackerStep{
+				{at: 0, gas: 350},
+				{at: 2, gas: 350},
+				{at: 4, gas: 350},
+				{at: 5, gas: 350, event: "fire"},
+				{at: 6, gas: 350},
+				{at: 30, gas: 350},
+				{at: 31, gas: 200, event: "clear"},
+				{at: 32, gas: 350},
+				{at: 37, gas: 350, event: "fire"},
+			},
+		},
+		{
+			name: "interrupted duration starts over",
+			rule: models.Rule{Condition: gasAbove(300), ForSeconds: 5},
+			steps: []trackerStep{
+				{at: 0, gas: 350},
+				{at: 4, gas: 350},
+				{at: 5, gas: 200},
+				{at: 6, gas: 350},
+				{at: 10, gas: 350},
+				{at: 11, gas: 350, event: "fire"},
+			},
+		},
+		{
+			name: "held for samples",
+			rule: models.Rule{Condition: gasAbove(300), ForSamples: 3},
+			steps: []trackerStep{
+				{at: 0, gas: 350},
+				{at: 1, gas: 350},
+				{at: 2, gas: 200},
+				{at: 3, gas: 350},
+				{at: 4, gas: 350},
+				{at: 5, gas: 350, event: "fire"},
+				{at: 6, gas: 350},
+				{at: 7, gas: 300, event: "clear"},
+			},
+		},
+		{
+			name: "samples and seconds both needed",
+			rule: models.Rule{Condition: gasAbove(300), ForSamples: 3, ForSeconds: 10},
+			steps: []trackerStep{
+				{at: 0, gas: 350},
+				{at: 1, gas: 350},
+				{at: 2, gas: 350},
+				{at: 10, gas: 350, event: "fire"},
+			},
+		},
+		{
+			name: "hysteresis",
+			rule: models.Rule{Condition: gasAbove(400), ClearCondition: gasBelow(300)},
+			steps: []trackerStep{
+				{at: 0, gas: 350},
+				{at: 1, gas: 450, event: "fire"},
+				{at: 2, gas: 450},
+				{at: 3, gas: 350},
+				{at: 4, gas: 450},
+				{at: 5, gas: 300},
+				{at: 6, gas: 250, event: "clear"},
+				{at: 7, gas: 350},
+				{at: 8, gas: 450, event: "fire"},
+			},
+		},
+		{
+			name: "scope",
+			rule: models.Rule{Condition: gasAbove(400), ClearCondition: gasBelow(300)},
+			steps: []trackerStep{
+				{at: 0, gas: 450, out: true},
+				{at: 1, gas: 450, event: "fire"},
+				{at: 2, gas: 450, out: true},
+				{at: 3, gas: 350, out: true},
+				{at: 4, gas: 250, out: true, event: "clear"},
+				{at: 5, gas: 450, out: true},
+			},
+		},
+		{
+			name: "leaving scope resets the duration",
+			rule: models.Rule{Condition: gasAbove(300), ForSamples: 2},
+			steps: []trackerStep{
+				{at: 0, gas: 350},
+				{at: 1, gas: 350, out: true},
+				{at: 2, gas: 350},
+				{at: 3, gas: 350, event: "fire"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.ID = primitive.NewObjectID()
+			tt.rule.Name = tt.name
+			key := ruleKey{rule: tt.rule.ID, device: "test"}
+			runTracker(t, newRuleTracker(false), compileRule(tt.rule), key, tt.steps)
+		})
+	}
+}
+
+func TestRuleTrackerEvents(t *testing.T) {
+	rule := models.Rule{
+		ID:             primitive.NewObjectID(),
+		Name:           "Gas",
+		Condition:      gasAbove(400),
+		Actions:        []models.RuleAction{{Type: models.ActionCommand, Command: "relay=1"}},
+		ClearCondition: gasBelow(300),
+		ClearActions:   []models.RuleAction{{Type: models.ActionCommand, Command: "relay=0"}},
+	}
+	compiled := compileRule(rule)
+	key := ruleKey{rule: rule.ID, device: "test"}
+	tracker := newRuleTracker(false)
+
+	reading := &models.SensorReading{Gas: 450, Timestamp: trackerStart}
+	fired, ok := tracker.evaluate(compiled, key, true, RuleInput{Reading: reading})
+	if !ok || fired.cleared || fired.alert != "Gas: gas > 400 (current: 450)" {
+		t.Errorf("fire = %+v, %v, want alert %q", fired, ok, "Gas: gas > 400 (current: 450)")
+	}
+	if len(fired.actions) != 1 || fired.actions[0].Command != "relay=1" {
+		t.Errorf("fire actions = %+v, want relay=1", fired.actions)
+	}
+
+	reading = &models.SensorReading{Gas: 250, Timestamp: trackerStart.Add(time.Second)}
+	cleared, ok := tracker.evaluate(compiled, key, true, RuleInput{Reading: reading})
+	if !ok || !cleared.cleared || cleared.alert != "Gas: cleared" {
+		t.Errorf("clear = %+v, %v, want alert %q", cleared, ok, "Gas: cleared")
+	}
+	if len(cleared.actions) != 1 || cleared.actions[0].Command != "relay=0" {
+		t.Errorf("clear actions = %+v, want relay=0", cleared.actions)
+	}
+}
+
+func TestRuleTrackerStatePerDevice(t *testing.T) {
+	rule := models.Rule{ID: primitive.NewObjectID(), Condition: gasAbove(300), ForSamples: 1}
+	compiled := compileRule(rule)
+	kitchen := ruleKey{rule: rule.ID, device: "kitchen"}
+	garage := ruleKey{rule: rule.ID, device: "garage"}
+	tracker := newRuleTracker(false)
+
+	runTracker(t, tracker, compiled, kitchen, []trackerStep{{at: 0, gas: 350, event: "fire"}})
+	runTracker(t, tracker, compiled, garage, []trackerStep{{at: 1, gas: 350, event: "fire"}})
+	runTracker(t, tracker, compiled, kitchen, []trackerStep{{at: 2, gas: 350}})
+
+	tracker.reset(kitchen)
+	runTracker(t, tracker, compiled, kitchen, []trackerStep{{at: 3, gas: 350, event: "fire"}})
+	runTracker(t, tracker, compiled, garage, []trackerStep{{at: 4, gas: 350}})
+
+	tracker.forget(func(primitive.ObjectID) bool { return false })
+	runTracker(t, tracker, compiled, garage, []trackerStep{{at: 5, gas: 350, event: "fire"}})
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/caphefalumi/smart-home/database"
+	"github.com/caphefalumi/smart-home/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SceneService handles scene operations
+type SceneService struct {
+	db         *database.Database
+	collection string
+}
+
+// NewSceneService creates a new scene service
+func NewSceneService(db *database.Database) *SceneService {
+	return &SceneService{
+		db:         db,
+		collection: "scenes",
+	}
+}
+
+// GetScenes retrieves all scenes
+func (s *SceneService) GetScenes() ([]models.Scene, error) {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	var scenes []models.Scene
+	err := coll.Find(ctx, bson.M{}).Sort("name").All(&scenes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scenes: %w", err)
+	}
+
+	return scenes, nil
+}
+
+// GetScene retrieves a scene by ID
+func (s *SceneService) GetScene(id string) (*models.Scene, error) {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scene ID: %w", err)
+	}
+
+	var scene models.Scene
+	if err := coll.Find(ctx, bson.M{"_id": objectID}).One(&scene); err != nil {
+		return nil, err
+	}
+
+	return &scene, nil
+}
+
+// CreateScene creates a new scene
+func (s *SceneService) CreateScene(scene *models.Scene) error {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	scene.ID = primitive.NewObjectID()
+	scene.CreatedAt = time.Now()
+	scene.UpdatedAt = scene.CreatedAt
+
+	_, err := coll.InsertOne(ctx, scene)
+	if err != nil {
+		return fmt.Errorf("failed to create scene: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateScene replaces the stored fields of an existing scene
+func (s *SceneService) UpdateScene(scene *models.Scene) error {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	scene.UpdatedAt = time.Now()
+
+	if err := coll.ReplaceOne(ctx, bson.M{"_id": scene.ID}, scene); err != nil {
+		return fmt.Errorf("failed to update scene: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteScene deletes a scene by ID
+func (s *SceneService) DeleteScene(id string) error {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("invalid scene ID: %w", err)
+	}
+
+	err = coll.RemoveId(ctx, objectID)
+	if err != nil {
+		return fmt.Errorf("failed to delete scene: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/caphefalumi/smart-home/database"
+	"github.com/caphefalumi/smart-home/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ScheduleService handles schedule operations
+type ScheduleService struct {
+	db         *database.Database
+	collection string
+}
+
+// NewScheduleService creates a new schedule service
+func NewScheduleService(db *database.Database) *ScheduleService {
+	return &ScheduleService{
+		db:         db,
+		collection: "schedules",
+	}
+}
+
+// ValidateSchedule checks the timing fields of a schedule. Actions are
+// checked by the caller, which knows the commands a device accepts.
+func ValidateSchedule(schedule *models.Schedule) error {
+	if (schedule.Cron == "") == (schedule.At == nil) {
+		return fmt.Errorf("exactly one of cron or at is required")
+	}
+	if schedule.Cron != "" {
+		if _, err := ParseCron(schedule.Cron); err != nil {
+			return err
+		}
+	}
+
+	switch schedule.MissedRun {
+	case models.MissedSkip, models.MissedRun:
+	default:
+		return fmt.Errorf("invalid missedRun %q", schedule.MissedRun)
+	}
+	return nil
+}
+
+// MissedGrace is how late a run may start before it counts as missed
+const MissedGrace = time.Minute
+
+// IsMissed reports whether a run that fell due at due is skipped when it
+// starts at now: it is more than MissedGrace late and the schedule's policy
+// is not to run late
+func IsMissed(schedule *models.Schedule, due, now time.Time) bool {
+	return now.Sub(due) > MissedGrace && schedule.MissedRun != models.MissedRun
+}
+
+// NextRun returns the first run of a schedule after t, or nil when it will
+// not run again
+func NextRun(schedule *models.Schedule, t time.Time) *time.Time {
+	if schedule.At != nil {
+		if schedule.At.After(t) {
+			at := *schedule.At
+			return &at
+		}
+		return nil
+	}
+
+	cron, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return nil
+	}
+	next := cron.Next(t)
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// GetSchedules retrieves all schedules, optionally scoped to a device
+func (s *ScheduleService) GetSchedules(deviceID string) ([]models.Schedule, error) {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	query := bson.M{}
+	if deviceID != "" {
+		query["deviceId"] = deviceID
+	}
+
+	var schedules []models.Schedule
+	err := coll.Find(ctx, query).Sort("createdAt").All(&schedules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schedules: %w", err)
+	}
+
+	return schedules, nil
+}
+
+// GetSchedule retrieves a schedule by ID
+func (s *ScheduleService) GetSchedule(id string) (*models.Schedule, error) {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule ID: %w", err)
+	}
+
+	var schedule models.Schedule
+	if err := coll.Find(ctx, bson.M{"_id": objectID}).One(&schedule); err != nil {
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+// CreateSchedule creates a new schedule
+func (s *ScheduleService) CreateSchedule(schedule *models.Schedule) error {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	schedule.ID = primitive.NewObjectID()
+	schedule.CreatedAt = time.Now()
+	schedule.UpdatedAt = schedule.CreatedAt
+
+	_, err := coll.InsertOne(ctx, schedule)
+	if err != nil {
+		return fmt.Errorf("failed to create schedule: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateSchedule replaces the stored fields of an existing schedule
+func (s *ScheduleService) UpdateSchedule(schedule *models.Schedule) error {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	schedule.UpdatedAt = time.Now()
+
+	if err := coll.ReplaceOne(ctx, bson.M{"_id": schedule.ID}, schedule); err != nil {
+		return fmt.Errorf("failed to update schedule: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteSchedule deletes a schedule by ID
+func (s *ScheduleService) DeleteSchedule(id string) error {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("invalid schedule ID: %w", err)
+	}
+
+	err = coll.RemoveId(ctx, objectID)
+	if err != nil {
+		return fmt.Errorf("failed to delete schedule: %w", err)
+	}
+
+	return nil
+}
+
+// SetNextRun stores when a schedule runs next. Schedules that will not run
+// again are disabled.
+func (s *ScheduleService) SetNextRun(id primitive.ObjectID, next *time.Time) error {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	update := bson.M{"updatedAt": time.Now()}
+	unset := bson.M{}
+	if next != nil {
+		update["nextRunAt"] = *next
+	} else {
+		update["enabled"] = false
+		unset["nextRunAt"] = ""
+	}
+
+	change := bson.M{"$set": update}
+	if len(unset) > 0 {
+		change["$unset"] = unset
+	}
+
+	if err := coll.UpdateId(ctx, id, change); err != nil {
+		return fmt.Errorf("failed to set next run: %w", err)
+	}
+
+	return nil
+}
+
+// RecordRun stores the outcome of a run
+func (s *ScheduleService) RecordRun(id primitive.ObjectID, ranAt time.Time, result, runErr string) error {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	update := bson.M{"$set": bson.M{
+		"lastRunAt":  ranAt,
+		"lastResult": result,
+		"lastError":  runErr,
+	}}
+
+	if err := coll.UpdateId(ctx, id, update); err != nil {
+		return fmt.Errorf("failed to record run: %w", err)
+	}
+
+	return nil
+}
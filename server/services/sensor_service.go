@@ -24,6 +24,19 @@ func NewSensorService(db *database.Database) *SensorService {
 	}
 }
 
+// deviceFilter adds a device scope to a query filter. Documents stored before
+// devices were introduced have no device ID and belong to the default device.
+func deviceFilter(filter bson.M, deviceID string) bson.M {
+	switch deviceID {
+	case "":
+	case models.DefaultDeviceID:
+		filter["deviceId"] = bson.M{"$in": []interface{}{deviceID, nil}}
+	default:
+		filter["deviceId"] = deviceID
+	}
+	return filter
+}
+
 // SaveSensorData saves sensor data to MongoDB
 func (s *SensorService) SaveSensorData(data *models.SensorData) error {
 	ctx := context.Background()
@@ -60,13 +73,13 @@ func (s *SensorService) SaveBulkSensorData(data []models.SensorData) error {
 	return nil
 }
 
-// GetSensorHistory retrieves paginated sensor history
-func (s *SensorService) GetSensorHistory(limit, skip int, startDate, endDate *time.Time) ([]models.SensorData, int64, error) {
+// GetSensorHistory retrieves paginated sensor history, optionally scoped to a device
+func (s *SensorService) GetSensorHistory(deviceID string, limit, skip int, startDate, endDate *time.Time) ([]models.SensorData, int64, error) {
 	ctx := context.Background()
 	coll := s.db.GetCollection(s.collection)
 
 	// Build query filter
-	filter := bson.M{}
+	filter := deviceFilter(bson.M{}, deviceID)
 	if startDate != nil || endDate != nil {
 		timeFilter := bson.M{}
 		if startDate != nil {
@@ -93,8 +106,9 @@ func (s *SensorService) GetSensorHistory(limit, skip int, startDate, endDate *ti
 	return results, total, nil
 }
 
-// GetStatistics calculates sensor statistics for the specified time range
-func (s *SensorService) GetStatistics(sensorType string, hours int) (*models.Statistics, error) {
+// GetStatistics calculates sensor statistics for the specified time range,
+// optionally scoped to a device
+func (s *SensorService) GetStatistics(deviceID, sensorType string, hours int) (*models.Statistics, error) {
 	ctx := context.Background()
 	coll := s.db.GetCollection(s.collection)
 
@@ -104,9 +118,9 @@ func (s *SensorService) GetStatistics(sensorType string, hours int) (*models.Sta
 
 	// Match time range
 	pipeline = append(pipeline, bson.M{
-		"$match": bson.M{
+		"$match": deviceFilter(bson.M{
 			"timestamp": bson.M{"$gte": startTime},
-		},
+		}, deviceID),
 	})
 
 	// Group and calculate statistics
@@ -208,8 +222,9 @@ func (s *SensorService) GetStatistics(sensorType string, hours int) (*models.Sta
 	return stats, nil
 }
 
-// GetTrends calculates hourly trends for the specified time range
-func (s *SensorService) GetTrends(hours int) ([]models.TrendData, error) {
+// GetTrends calculates hourly trends for the specified time range,
+// optionally scoped to a device
+func (s *SensorService) GetTrends(deviceID string, hours int) ([]models.TrendData, error) {
 	ctx := context.Background()
 	coll := s.db.GetCollection(s.collection)
 
@@ -217,9 +232,9 @@ func (s *SensorService) GetTrends(hours int) ([]models.TrendData, error) {
 
 	pipeline := []bson.M{
 		{
-			"$match": bson.M{
+			"$match": deviceFilter(bson.M{
 				"timestamp": bson.M{"$gte": startTime},
-			},
+			}, deviceID),
 		},
 		{
 			"$group": bson.M{
@@ -250,17 +265,17 @@ func (s *SensorService) GetTrends(hours int) ([]models.TrendData, error) {
 	return results, nil
 }
 
-// GetAlerts retrieves recent sensor data with alerts
-func (s *SensorService) GetAlerts(limit int) ([]models.SensorData, error) {
+// GetAlerts retrieves recent sensor data with alerts, optionally scoped to a device
+func (s *SensorService) GetAlerts(deviceID string, limit int) ([]models.SensorData, error) {
 	ctx := context.Background()
 	coll := s.db.GetCollection(s.collection)
 
-	filter := bson.M{
+	filter := deviceFilter(bson.M{
 		"alerts": bson.M{
 			"$exists": true,
 			"$not":    bson.M{"$size": 0},
 		},
-	}
+	}, deviceID)
 
 	var results []models.SensorData
 	err := coll.Find(ctx, filter).Sort("-timestamp").Limit(int64(limit)).All(&results)
@@ -270,3 +285,27 @@ func (s *SensorService) GetAlerts(limit int) ([]models.SensorData, error) {
 
 	return results, nil
 }
+
+// EachReading calls fn for every reading of a device between start and end,
+// oldest first, stopping at the first error
+func (s *SensorService) EachReading(deviceID string, start, end time.Time, fn func(*models.SensorData) error) error {
+	ctx := context.Background()
+	coll := s.db.GetCollection(s.collection)
+
+	filter := deviceFilter(bson.M{"timestamp": bson.M{"$gte": start, "$lte": end}}, deviceID)
+	cursor := coll.Find(ctx, filter).Sort("timestamp").Cursor()
+	defer cursor.Close()
+
+	var data models.SensorData
+	for cursor.Next(&data) {
+		if err := fn(&data); err != nil {
+			return err
+		}
+		data = models.SensorData{}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to read sensor history: %w", err)
+	}
+
+	return nil
+}
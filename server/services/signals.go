@@ -0,0 +1,104 @@
+package services
+
+import (
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+)
+
+// maxSignalSamples bounds the readings kept by a SignalHistory
+const maxSignalSamples = 7200
+
+// SignalHistory keeps recent readings of a device to derive rule statistics
+// such as deltas and moving averages. It is not safe for concurrent use.
+type SignalHistory struct {
+	readings []*models.SensorReading
+	retain   time.Duration
+}
+
+// NewSignalHistory creates a history that keeps readings for the longest
+// statistic window
+func NewSignalHistory() *SignalHistory {
+	return &SignalHistory{retain: models.MaxStatWindow * time.Second}
+}
+
+// Add appends a reading and drops readings older than the longest window
+func (h *SignalHistory) Add(reading *models.SensorReading) {
+	h.readings = append(h.readings, reading)
+
+	cutoff := reading.Timestamp.Add(-h.retain)
+	drop := 0
+	for drop < len(h.readings) && h.readings[drop].Timestamp.Before(cutoff) {
+		drop++
+	}
+	if over := len(h.readings) - maxSignalSamples; over > drop {
+		drop = over
+	}
+	if drop > 0 {
+		h.readings = append(h.readings[:0], h.readings[drop:]...)
+	}
+}
+
+// Stat computes a statistic of a sensor over the readings of the last window
+// ending at the latest reading. It reports false when the readings are too
+// few or do not carry the sensor.
+func (h *SignalHistory) Stat(sensor, stat string, window time.Duration) (float64, bool) {
+	if len(h.readings) == 0 {
+		return 0, false
+	}
+
+	cutoff := h.readings[len(h.readings)-1].Timestamp.Add(-window)
+	var times, values []float64
+	for _, reading := range h.readings {
+		if reading.Timestamp.Before(cutoff) {
+			continue
+		}
+		if value, ok := reading.Value(sensor); ok {
+			times = append(times, reading.Timestamp.Sub(cutoff).Minutes())
+			values = append(values, value)
+		}
+	}
+
+	n := len(values)
+	switch stat {
+	case models.StatAverage:
+		if n == 0 {
+			return 0, false
+		}
+		return mean(values), true
+	case models.StatDelta:
+		if n < 2 {
+			return 0, false
+		}
+		return values[n-1] - values[0], true
+	case models.StatDeviation:
+		if n < 2 {
+			return 0, false
+		}
+		return values[n-1] - mean(values[:n-1]), true
+	case models.StatSlope:
+		if n < 2 {
+			return 0, false
+		}
+		meanT, meanV := mean(times), mean(values)
+		var num, den float64
+		for i := range values {
+			num += (times[i] - meanT) * (values[i] - meanV)
+			den += (times[i] - meanT) * (times[i] - meanT)
+		}
+		if den == 0 {
+			return 0, false
+		}
+		return num / den, true
+	}
+	return 0, false
+}
+
+// mean returns the average of values
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
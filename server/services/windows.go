@@ -0,0 +1,186 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+)
+
+// sunZenith is the official zenith of sunrise and sunset, in degrees,
+// accounting for refraction and the solar disc
+const sunZenith = 90.833
+
+// geoLocation is where sun events are computed for
+type geoLocation struct {
+	latitude  float64
+	longitude float64
+}
+
+// SetLocation sets the latitude and longitude used for sunrise and sunset
+// windows
+func (r *RuleService) SetLocation(latitude, longitude float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.location = &geoLocation{latitude: latitude, longitude: longitude}
+}
+
+// ValidateWindows checks a rule's active windows, including that sun-based
+// windows can be resolved
+func (r *RuleService) ValidateWindows(windows []models.ActiveWindow) error {
+	r.mutex.Lock()
+	location := r.location
+	r.mutex.Unlock()
+
+	for i := range windows {
+		if err := windows[i].Validate(); err != nil {
+			return fmt.Errorf("window %d: %w", i+1, err)
+		}
+		if windows[i].UsesSun() && location == nil {
+			return fmt.Errorf("window %d: sunrise and sunset need LATITUDE and LONGITUDE to be configured", i+1)
+		}
+	}
+	return nil
+}
+
+// InWindow reports whether a rule is inside one of its active windows at t.
+// Rules without windows are always active.
+func (r *RuleService) InWindow(rule *models.Rule, t time.Time) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.inWindow(rule, t)
+}
+
+// inWindow implements InWindow. Must be called with the mutex held.
+func (r *RuleService) inWindow(rule *models.Rule, t time.Time) bool {
+	if len(rule.Windows) == 0 {
+		return true
+	}
+	for i := range rule.Windows {
+		if windowContains(&rule.Windows[i], t, r.location) {
+			return true
+		}
+	}
+	return false
+}
+
+// windowContains reports whether t falls in the window. A window that wraps
+// past midnight may have opened the day before.
+func windowContains(w *models.ActiveWindow, t time.Time, location *geoLocation) bool {
+	t = t.In(time.Local)
+	today := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+
+	for _, day := range []time.Time{today, today.AddDate(0, 0, -1)} {
+		if !w.OpensOn(day) {
+			continue
+		}
+
+		from, ok := windowBoundary(w.From, day, location)
+		if !ok {
+			continue
+		}
+		to := day.AddDate(0, 0, 1)
+		if w.To != "" {
+			if to, ok = windowBoundary(w.To, day, location); !ok {
+				continue
+			}
+			if !to.After(from) {
+				if to, ok = windowBoundary(w.To, day.AddDate(0, 0, 1), location); !ok {
+					continue
+				}
+			}
+		}
+
+		if !t.Before(from) && t.Before(to) {
+			return true
+		}
+	}
+	return false
+}
+
+// windowBoundary resolves a window boundary on a day. An empty boundary is
+// midnight. Sun events fail to resolve without a location or on days the
+// sun does not rise or set.
+func windowBoundary(spec string, day time.Time, location *geoLocation) (time.Time, bool) {
+	if spec == "" {
+		return day, true
+	}
+
+	boundary, err := models.ParseTimeOfDay(spec)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if boundary.Sun == "" {
+		return day.Add(time.Duration(boundary.Minutes) * time.Minute), true
+	}
+
+	if location == nil {
+		return time.Time{}, false
+	}
+	event, ok := sunEvent(day, location.latitude, location.longitude, boundary.Sun == "sunrise")
+	if !ok {
+		return time.Time{}, false
+	}
+	return event.Add(boundary.Offset), true
+}
+
+// sunEvent computes the local time of sunrise or sunset on a day using the
+// sunrise equation from the Almanac for Computers, accurate to a minute or two
+func sunEvent(day time.Time, latitude, longitude float64, rising bool) (time.Time, bool) {
+	rad := math.Pi / 180
+	lngHour := longitude / 15
+
+	approx := 18.0
+	if rising {
+		approx = 6
+	}
+	t := float64(day.YearDay()) + (approx-lngHour)/24
+
+	// Sun's mean anomaly and true longitude
+	m := 0.9856*t - 3.289
+	l := normalizeDegrees(m + 1.916*math.Sin(m*rad) + 0.020*math.Sin(2*m*rad) + 282.634)
+
+	// Right ascension, in the same quadrant as the longitude, in hours
+	ra := normalizeDegrees(math.Atan(0.91764*math.Tan(l*rad)) / rad)
+	ra += math.Floor(l/90)*90 - math.Floor(ra/90)*90
+	ra /= 15
+
+	// Declination and local hour angle
+	sinDec := 0.39782 * math.Sin(l*rad)
+	cosDec := math.Cos(math.Asin(sinDec))
+	cosH := (math.Cos(sunZenith*rad) - sinDec*math.Sin(latitude*rad)) / (cosDec * math.Cos(latitude*rad))
+	if cosH > 1 || cosH < -1 {
+		return time.Time{}, false
+	}
+	h := math.Acos(cosH) / rad
+	if rising {
+		h = 360 - h
+	}
+	h /= 15
+
+	localMean := h + ra - 0.06571*t - 6.622
+	ut := math.Mod(localMean-lngHour+48, 24)
+
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	event := midnight.Add(time.Duration(ut * float64(time.Hour))).In(day.Location())
+
+	// The UTC date of the event can differ from the local day
+	if y, m, d := event.Date(); d != day.Day() || m != day.Month() || y != day.Year() {
+		if event.Before(day) {
+			event = event.AddDate(0, 0, 1)
+		} else {
+			event = event.AddDate(0, 0, -1)
+		}
+	}
+	return event, true
+}
+
+// normalizeDegrees maps an angle into [0, 360)
+func normalizeDegrees(angle float64) float64 {
+	angle = math.Mod(angle, 360)
+	if angle < 0 {
+		angle += 360
+	}
+	return angle
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caphefalumi/smart-home/models"
+)
+
+var (
+	hanoi        = &geoLocation{latitude: 21.0285, longitude: 105.8542}
+	sanFrancisco = &geoLocation{latitude: 37.7749, longitude: -122.4194}
+	london       = &geoLocation{latitude: 51.5074, longitude: -0.1278}
+	tromso       = &geoLocation{latitude: 69.6492, longitude: 18.9553}
+
+	ict = time.FixedZone("ICT", 7*60*60)
+	pdt = time.FixedZone("PDT", -7*60*60)
+)
+
+func TestSunEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		day      time.Time
+		location *geoLocation
+		rising   bool
+		want     string // local "15:04", empty when the sun does not rise or set
+	}{
+		{"hanoi sunrise, june solstice", time.Date(2026, 6, 21, 0, 0, 0, 0, ict), hanoi, true, "05:16"},
+		{"hanoi sunset, june solstice", time.Date(2026, 6, 21, 0, 0, 0, 0, ict), hanoi, false, "18:41"},
+		{"san francisco sunrise, june solstice", time.Date(2026, 6, 21, 0, 0, 0, 0, pdt), sanFrancisco, true, "05:48"},
+		{"san francisco sunset, june solstice", time.Date(2026, 6, 21, 0, 0, 0, 0, pdt), sanFrancisco, false, "20:35"},
+		{"london sunrise, december solstice", time.Date(2026, 12, 21, 0, 0, 0, 0, time.UTC), london, true, "08:04"},
+		{"london sunset, december solstice", time.Date(2026, 12, 21, 0, 0, 0, 0, time.UTC), london, false, "15:54"},
+		{"midnight sun", time.Date(2026, 6, 21, 0, 0, 0, 0, time.UTC), tromso, true, ""},
+		{"polar night", time.Date(2026, 12, 21, 0, 0, 0, 0, time.UTC), tromso, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := sunEvent(tt.day, tt.location.latitude, tt.location.longitude, tt.rising)
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("sunEvent() = %s, want no event", got)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("sunEvent() found no event, want %s", tt.want)
+			}
+
+			clock, _ := time.Parse("15:04", tt.want)
+			want := tt.day.Add(time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute)
+			if diff := got.Sub(want); diff < -3*time.Minute || diff > 3*time.Minute {
+				t.Errorf("sunEvent() = %s, want %s within 3m", got.Format("2006-01-02 15:04"), want.Format("2006-01-02 15:04"))
+			}
+		})
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	local := time.Local
+	time.Local = ict
+	defer func() { time.Local = local }()
+
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, ict)
+	}
+
+	overnight := models.ActiveWindow{From: "22:00", To: "06:00"}
+	fridayNight := models.ActiveWindow{Days: []string{"fri"}, From: "22:00", To: "06:00"}
+	weekend := models.ActiveWindow{Days: []string{"sat", "sun"}}
+	dates := models.ActiveWindow{StartDate: "2026-03-05", EndDate: "2026-03-06"}
+	datedNight := models.ActiveWindow{StartDate: "2026-03-05", EndDate: "2026-03-06", From: "22:00", To: "06:00"}
+	evening := models.ActiveWindow{From: "sunset-30m", To: "23:00"}
+	night := models.ActiveWindow{From: "sunset", To: "sunrise"}
+
+	tests := []struct {
+		name     string
+		window   models.ActiveWindow
+		location *geoLocation
+		t        time.Time
+		want     bool
+	}{
+		{"overnight, evening", overnight, nil, at(3, 4, 23, 0), true},
+		{"overnight, after midnight", overnight, nil, at(3, 5, 3, 0), true},
+		{"overnight, opens inclusive", overnight, nil, at(3, 4, 22, 0), true},
+		{"overnight, closes exclusive", overnight, nil, at(3, 5, 6, 0), false},
+		{"overnight, midday", overnight, nil, at(3, 4, 12, 0), false},
+		{"day applies to opening, friday evening", fridayNight, nil, at(3, 6, 23, 0), true},
+		{"day applies to opening, saturday morning", fridayNight, nil, at(3, 7, 3, 0), true},
+		{"day applies to opening, friday morning", fridayNight, nil, at(3, 6, 3, 0), false},
+		{"day applies to opening, saturday evening", fridayNight, nil, at(3, 7, 23, 0), false},
+		{"whole day, saturday", weekend, nil, at(3, 7, 0, 0), true},
+		{"whole day, sunday night", weekend, nil, at(3, 8, 23, 59), true},
+		{"whole day, monday", weekend, nil, at(3, 9, 0, 0), false},
+		{"before start date", dates, nil, at(3, 4, 23, 59), false},
+		{"on start date", dates, nil, at(3, 5, 0, 0), true},
+		{"on end date", dates, nil, at(3, 6, 23, 59), true},
+		{"after end date", dates, nil, at(3, 7, 0, 0), false},
+		{"opened on end date", datedNight, nil, at(3, 7, 3, 0), true},
+		{"opened after end date", datedNight, nil, at(3, 7, 23, 0), false},
+		{"sun offset, before", evening, hanoi, at(6, 21, 18, 0), false},
+		{"sun offset, after", evening, hanoi, at(6, 21, 18, 20), true},
+		{"sunset to sunrise, night", night, hanoi, at(6, 22, 2, 0), true},
+		{"sunset to sunrise, after sunrise", night, hanoi, at(6, 22, 5, 30), false},
+		{"sunset to sunrise, afternoon", night, hanoi, at(6, 21, 18, 30), false},
+		{"sun without location", night, nil, at(6, 22, 2, 0), false},
+		{"no sunset in polar night", night, tromso, at(12, 21, 23, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := windowContains(&tt.window, tt.t, tt.location); got != tt.want {
+				t.Errorf("windowContains(%s) = %v, want %v", tt.t.Format("Mon 2006-01-02 15:04"), got, tt.want)
+			}
+		})
+	}
+}